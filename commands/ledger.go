@@ -0,0 +1,70 @@
+// Package commands holds the maintenance commands of the app.
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// errNotReconciled fails the reconcile command when the ledger is off.
+var errNotReconciled = errors.New("the ledger is not reconciled")
+
+// NewReconcileCommand checks the ledger: every entry must balance and every
+// rent must have the entries its payments call for. It fails when the ledger
+// is off, so the process exits with a non-zero status.
+func NewReconcileCommand(app core.App) *cobra.Command {
+	var fix bool
+
+	command := &cobra.Command{
+		Use:          "reconcile-ledger",
+		Short:        "Check that the ledger balances and matches the rent payments",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			report, err := services.ReconcileLedger(app, fix)
+			if err != nil {
+				return err
+			}
+
+			out := command.OutOrStdout()
+			fmt.Fprintf(out, "entries: %d\n", report.Entries)
+
+			accounts := make([]string, 0, len(report.Accounts))
+			for account := range report.Accounts {
+				accounts = append(accounts, account)
+			}
+			sort.Strings(accounts)
+			total := 0.0
+			for _, account := range accounts {
+				fmt.Fprintf(out, "  %-16s %14.2f\n", account, report.Accounts[account])
+				total += report.Accounts[account]
+			}
+			fmt.Fprintf(out, "  %-16s %14.2f\n", "total", total)
+
+			for _, id := range report.Unbalanced {
+				fmt.Fprintf(out, "unbalanced entry: %s\n", id)
+			}
+			for i, reference := range report.Missing {
+				state := "missing"
+				if i < report.Posted {
+					state = "posted"
+				}
+				fmt.Fprintf(out, "%s entry: %s\n", state, reference)
+			}
+
+			if !report.OK() {
+				return errNotReconciled
+			}
+			fmt.Fprintln(out, "ok")
+			return nil
+		},
+	}
+	command.Flags().BoolVar(&fix, "fix", false, "post the missing entries")
+
+	return failOnTerminate(app, command)
+}
@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"fmt"
+
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// NewSchedulePayoutsCommand creates a payout batch right away, without
+// waiting for the weekly cron job.
+func NewSchedulePayoutsCommand(app core.App) *cobra.Command {
+	return failOnTerminate(app, &cobra.Command{
+		Use:          "schedule-payouts",
+		Short:        "Group the settled owner earnings into a payout batch",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			batch, err := services.SchedulePayouts(app)
+			if err != nil {
+				return err
+			}
+
+			out := command.OutOrStdout()
+			if batch == nil {
+				fmt.Fprintln(out, "nothing to pay out")
+				return nil
+			}
+			fmt.Fprintf(out, "batch %s: %d payouts, %.2f %s\n",
+				batch.Id, batch.GetInt("payouts_count"), batch.GetFloat("total"), services.Currency)
+			return nil
+		},
+	})
+}
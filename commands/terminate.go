@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// failOnTerminate makes app.Start() return the error of the command, which
+// PocketBase otherwise drops, so that main can exit with a non-zero status
+// after the terminate hooks ran.
+func failOnTerminate(app core.App, command *cobra.Command) *cobra.Command {
+	run := command.RunE
+	command.SilenceErrors = true
+	command.RunE = func(command *cobra.Command, args []string) error {
+		err := run(command, args)
+		if err != nil {
+			app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+				if nextErr := e.Next(); nextErr != nil {
+					return nextErr
+				}
+				return err
+			})
+		}
+		return err
+	}
+	return command
+}
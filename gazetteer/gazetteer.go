@@ -0,0 +1,246 @@
+// Package gazetteer is an embedded dataset of Kazakhstan cities and districts
+// used to turn free-text locations into canonical ids.
+package gazetteer
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	TypeCity     = "city"
+	TypeDistrict = "district"
+)
+
+// minPrefixKey is the shortest key that is allowed to match as a prefix
+// (so "Бостандыкский" matches "Бостандык").
+const minPrefixKey = 4
+
+//go:embed kz_locations.json
+var rawLocations []byte
+
+type Location struct {
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Parent  string   `json:"parent,omitempty"`
+	NameRu  string   `json:"name_ru"`
+	NameKk  string   `json:"name_kk"`
+	NameEn  string   `json:"name_en"`
+	Aliases []string `json:"aliases,omitempty"`
+	Lat     float64  `json:"lat"`
+	Lng     float64  `json:"lng"`
+
+	keys []string
+}
+
+var (
+	locations []*Location
+	byID      = map[string]*Location{}
+)
+
+func init() {
+	if err := json.Unmarshal(rawLocations, &locations); err != nil {
+		panic("gazetteer: " + err.Error())
+	}
+	for _, loc := range locations {
+		for _, name := range append([]string{loc.NameRu, loc.NameKk, loc.NameEn}, loc.Aliases...) {
+			if k := key(name); k != "" {
+				loc.keys = append(loc.keys, k)
+			}
+		}
+		byID[loc.ID] = loc
+	}
+}
+
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "sh", 'ъ': "", 'ы': "i", 'ь': "", 'э': "e", 'ю': "iu",
+	'я': "ia", 'ә': "a", 'ғ': "g", 'қ': "k", 'ң': "n", 'ө': "o", 'ұ': "u", 'ү': "u",
+	'һ': "h", 'і': "i",
+	// latin kazakh alphabet
+	'ä': "a", 'ğ': "g", 'ı': "i", 'ñ': "n", 'ö': "o", 'ş': "sh", 'ū': "u", 'ü': "u",
+	// latin spelling variants
+	'y': "i", 'q': "k", 'x': "h", 'j': "zh",
+}
+
+var latinReplacer = strings.NewReplacer("kh", "h", "gh", "g")
+
+// genericWords are dropped from the keys ("г.", "р-н", "district", ...).
+var genericWords = map[string]bool{
+	"g": true, "gor": true, "gorod": true, "kala": true, "kalasi": true, "city": true,
+	"r": true, "n": true, "rn": true, "raion": true, "raiona": true, "rajon": true,
+	"audani": true, "audan": true, "district": true, "mkr": true, "mikroraion": true,
+	"obl": true, "oblast": true, "oblisi": true,
+}
+
+func words(text string) []string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if t, ok := translit[r]; ok {
+			b.WriteString(t)
+		} else if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+
+	result := []string{}
+	for _, w := range strings.Fields(latinReplacer.Replace(b.String())) {
+		if !genericWords[w] {
+			result = append(result, w)
+		}
+	}
+	return result
+}
+
+// key is the spelling-insensitive form of a location name.
+func key(text string) string {
+	return strings.Join(words(text), "")
+}
+
+func (l *Location) matches(k string) bool {
+	for _, lk := range l.keys {
+		if k == lk || (len(lk) >= minPrefixKey && strings.HasPrefix(k, lk)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Label is the display name, e.g. "Бостандыкский район, Алматы".
+func (l *Location) Label() string {
+	if parent, ok := byID[l.Parent]; ok {
+		return l.NameRu + ", " + parent.NameRu
+	}
+	return l.NameRu
+}
+
+func Get(id string) (*Location, bool) {
+	loc, ok := byID[id]
+	return loc, ok
+}
+
+// candidates splits the text into comma separated parts and their single words.
+func candidates(text string) []string {
+	result := []string{}
+	for _, part := range strings.Split(text, ",") {
+		ws := words(part)
+		if len(ws) == 0 {
+			continue
+		}
+		result = append(result, strings.Join(ws, ""))
+		if len(ws) > 1 {
+			result = append(result, ws...)
+		}
+	}
+	return result
+}
+
+// Resolve returns the most specific location mentioned in the text.
+// The city is looked up first so that "Астана, Алматы район" resolves to
+// the Almaty district of Astana and not to the city of Almaty.
+func Resolve(text string) (*Location, bool) {
+	parts := candidates(text)
+
+	var city *Location
+	cityPart := -1
+	for i, part := range parts {
+		for _, loc := range locations {
+			if loc.Type == TypeCity && loc.matches(part) {
+				city = loc
+				cityPart = i
+				break
+			}
+		}
+		if city != nil {
+			break
+		}
+	}
+
+	for i, part := range parts {
+		if i == cityPart {
+			continue
+		}
+		var found *Location
+		for _, loc := range locations {
+			if loc.Type != TypeDistrict || !loc.matches(part) {
+				continue
+			}
+			if city != nil && loc.Parent != city.ID {
+				continue
+			}
+			if found != nil && city == nil {
+				// the same district name in different cities
+				found = nil
+				break
+			}
+			found = loc
+			if city != nil {
+				break
+			}
+		}
+		if found != nil {
+			return found, true
+		}
+	}
+
+	return city, city != nil
+}
+
+// Search returns locations for autocomplete, best matches first.
+func Search(q string, limit int) []*Location {
+	k := key(q)
+	if k == "" {
+		return []*Location{}
+	}
+
+	type scored struct {
+		loc   *Location
+		score int
+	}
+	matches := []scored{}
+	for _, loc := range locations {
+		best := 0
+		for i, lk := range loc.keys {
+			score := 0
+			switch {
+			case lk == k:
+				score = 4
+			case strings.HasPrefix(lk, k):
+				score = 3
+			case len(k) >= 3 && strings.Contains(lk, k):
+				score = 1
+			}
+			// own names rank above aliases
+			if score > 0 && i < 3 {
+				score++
+			}
+			best = max(best, score)
+		}
+		if best > 0 {
+			if loc.Type == TypeCity {
+				best++
+			}
+			matches = append(matches, scored{loc, best})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	result := make([]*Location, 0, min(limit, len(matches)))
+	for _, m := range matches {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, m.loc)
+	}
+	return result
+}
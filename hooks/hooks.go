@@ -0,0 +1,86 @@
+package hooks
+
+import (
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func RegisterHooks(app core.App) {
+	registerJobs(app)
+
+	// derived fields, normalized tags and the canonical location from the gazetteer
+	app.OnRecordCreate("items").BindFunc(func(e *core.RecordEvent) error {
+		services.SetItemPrice(e.Record)
+		services.SetItemFlags(e.App, e.Record)
+		services.NormalizeItemTags(e.Record)
+		services.NormalizeItemLocation(e.Record)
+		return saveItemTags(e)
+	})
+
+	app.OnRecordUpdate("items").BindFunc(func(e *core.RecordEvent) error {
+		services.SetItemPrice(e.Record)
+		services.SetItemFlags(e.App, e.Record)
+		services.NormalizeItemTags(e.Record)
+		services.NormalizeItemLocation(e.Record)
+		return saveItemTags(e)
+	})
+
+	app.OnRecordDelete("items").BindFunc(func(e *core.RecordEvent) error {
+		tagIDs := e.Record.GetStringSlice("item_tags")
+		if err := e.Next(); err != nil {
+			return err
+		}
+		return services.RecountTags(e.App, tagIDs)
+	})
+
+	// the ledger follows the money of the rent; the payment statuses are
+	// changed inside transactions, so a failed posting rolls them back
+	app.OnRecordUpdate("rents").BindFunc(func(e *core.RecordEvent) error {
+		original := e.Record.Original()
+		changed := original.GetString("payment_status") != e.Record.GetString("payment_status") ||
+			original.GetString("deposit_status") != e.Record.GetString("deposit_status")
+		if err := e.Next(); err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+		return services.PostRentLedger(e.App, e.Record)
+	})
+
+	// keep the items search index in sync
+	app.OnRecordAfterCreateSuccess("items").BindFunc(func(e *core.RecordEvent) error {
+		if err := services.IndexItem(e.App, e.Record); err != nil {
+			e.App.Logger().Error("failed to index item", "id", e.Record.Id, "error", err)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess("items").BindFunc(func(e *core.RecordEvent) error {
+		if err := services.IndexItem(e.App, e.Record); err != nil {
+			e.App.Logger().Error("failed to index item", "id", e.Record.Id, "error", err)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess("items").BindFunc(func(e *core.RecordEvent) error {
+		if err := services.UnindexItem(e.App, e.Record.Id); err != nil {
+			e.App.Logger().Error("failed to unindex item", "id", e.Record.Id, "error", err)
+		}
+		return e.Next()
+	})
+}
+
+// saveItemTags links the item to its tag records and refreshes the usage
+// counts of the tags it gained or lost once the item is saved.
+func saveItemTags(e *core.RecordEvent) error {
+	previous, err := services.SyncItemTags(e.App, e.Record)
+	if err != nil {
+		return err
+	}
+	if err := e.Next(); err != nil {
+		return err
+	}
+	return services.RecountTags(e.App, append(previous, e.Record.GetStringSlice("item_tags")...))
+}
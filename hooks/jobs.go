@@ -0,0 +1,39 @@
+package hooks
+
+import (
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// payoutsSchedule runs the payouts every Monday morning (UTC), the batch
+// goes to the bank during the week.
+const payoutsSchedule = "0 6 * * 1"
+
+// depositsSchedule checks the expired damage claim windows.
+const depositsSchedule = "*/15 * * * *"
+
+// registerJobs adds the periodic jobs to the PocketBase cron.
+func registerJobs(app core.App) {
+	app.Cron().MustAdd("payouts", payoutsSchedule, func() {
+		batch, err := services.SchedulePayouts(app)
+		if err != nil {
+			app.Logger().Error("failed to schedule payouts", "error", err)
+			return
+		}
+		if batch != nil {
+			app.Logger().Info("payout batch scheduled", "id", batch.Id, "total", batch.GetFloat("total"))
+		}
+	})
+
+	// deposits nobody claimed in time go back to the renters
+	app.Cron().MustAdd("deposits", depositsSchedule, func() {
+		closed, err := services.ReleaseExpiredDeposits(app)
+		if err != nil {
+			app.Logger().Error("failed to release expired deposits", "error", err)
+		}
+		if closed > 0 {
+			app.Logger().Info("deposits released after the claim window", "rents", closed)
+		}
+	})
+}
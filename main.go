@@ -5,8 +5,12 @@ import (
 	"os"
 	"strings"
 
+	"uley_be/commands"
+	appHooks "uley_be/hooks"
 	_ "uley_be/migrations"
+	"uley_be/payments"
 	appRouter "uley_be/router"
+	"uley_be/services"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/plugins/migratecmd"
@@ -15,10 +19,24 @@ import (
 func main() {
 	app := pocketbase.New()
 
+	provider, err := payments.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if provider != nil {
+		services.SetPaymentProvider(app, provider)
+	} else {
+		log.Print("PAYMENT_PROVIDER is not set, payments are disabled")
+	}
+
+	appHooks.RegisterHooks(app)
 	appRouter.RegisterRoutes(app)
 
 	isGoRun := strings.HasPrefix(os.Args[0], os.TempDir())
 
+	app.RootCmd.AddCommand(commands.NewReconcileCommand(app))
+	app.RootCmd.AddCommand(commands.NewSchedulePayoutsCommand(app))
+
 	migratecmd.MustRegister(app, app.RootCmd, migratecmd.Config{
 		Automigrate: isGoRun,
 	})
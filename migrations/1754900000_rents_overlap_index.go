@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		rents, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+
+		// used by the booking overlap check
+		rents.AddIndex("idx_rents_item_dates", false, "`item`, `date_start`, `date_end`", "")
+
+		return app.Save(rents)
+	}, func(app core.App) error {
+		rents, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+
+		rents.RemoveIndex("idx_rents_item_dates")
+
+		return app.Save(rents)
+	})
+}
@@ -0,0 +1,152 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		statusesCol, err := app.FindCollectionByNameOrId("statuses")
+		if err != nil {
+			return err
+		}
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+
+		statusesCol.AddIndex("idx_statuses_name", true, "`name`", "")
+		if err := app.Save(statusesCol); err != nil {
+			return err
+		}
+
+		// seed statuses
+		statusNames := []string{
+			"requested",
+			"approved",
+			"handed_over",
+			"returned",
+			"closed",
+			"cancelled",
+			"declined",
+			"disputed",
+		}
+		createdStatuses := make(map[string]*core.Record)
+		for _, name := range statusNames {
+			if existing, _ := app.FindFirstRecordByData(statusesCol.Id, "name", name); existing != nil {
+				createdStatuses[name] = existing
+				continue
+			}
+			rec := core.NewRecord(statusesCol)
+			rec.Set("name", name)
+			if err := app.Save(rec); err != nil {
+				return err
+			}
+			createdStatuses[name] = rec
+		}
+
+		rentsCol.Fields.Add(&core.RelationField{
+			Name:         "status",
+			CollectionId: statusesCol.Id,
+			MaxSelect:    1,
+		})
+		if err := app.Save(rentsCol); err != nil {
+			return err
+		}
+
+		// history of every status change
+		historyCol := core.NewBaseCollection("rent_status_history")
+		historyCol.Fields.Add(
+			&core.RelationField{
+				Name:          "rent",
+				CollectionId:  rentsCol.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:         "from_status",
+				CollectionId: statusesCol.Id,
+				MaxSelect:    1,
+			},
+			&core.RelationField{
+				Name:         "to_status",
+				CollectionId: statusesCol.Id,
+				MaxSelect:    1,
+				Required:     true,
+			},
+			&core.RelationField{
+				Name:         "actor",
+				CollectionId: "_pb_users_auth_",
+				MaxSelect:    1,
+			},
+			&core.TextField{
+				Name: "note",
+				Max:  500,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		historyCol.AddIndex("idx_rent_status_history_rent", false, "`rent`, `created`", "")
+		if err := app.Save(historyCol); err != nil {
+			return err
+		}
+
+		// existing rents start as requested
+		rents, err := app.FindAllRecords(rentsCol.Id, dbx.HashExp{"status": ""})
+		if err != nil {
+			return err
+		}
+		for _, rent := range rents {
+			rent.Set("status", createdStatuses["requested"].Id)
+			if err := app.Save(rent); err != nil {
+				return err
+			}
+
+			entry := core.NewRecord(historyCol)
+			entry.Set("rent", rent.Id)
+			entry.Set("to_status", createdStatuses["requested"].Id)
+			entry.Set("actor", rent.GetString("renter"))
+			if err := app.Save(entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		if historyCol, _ := app.FindCollectionByNameOrId("rent_status_history"); historyCol != nil {
+			if err := app.Delete(historyCol); err != nil {
+				return err
+			}
+		}
+
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+		rentsCol.Fields.RemoveByName("status")
+		if err := app.Save(rentsCol); err != nil {
+			return err
+		}
+
+		statusesCol, err := app.FindCollectionByNameOrId("statuses")
+		if err != nil {
+			return err
+		}
+		if _, err := app.DB().Delete(statusesCol.Name, nil).Execute(); err != nil {
+			return err
+		}
+		statusesCol.RemoveIndex("idx_statuses_name")
+
+		return app.Save(statusesCol)
+	})
+}
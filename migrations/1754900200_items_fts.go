@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		_, err := app.DB().NewQuery(`
+			CREATE VIRTUAL TABLE IF NOT EXISTS items_fts USING fts5(
+				item_id UNINDEXED,
+				title,
+				description,
+				tags,
+				tokenize = 'unicode61 remove_diacritics 2'
+			)
+		`).Execute()
+		if err != nil {
+			return err
+		}
+
+		// backfill existing items
+		tagRegex := regexp.MustCompile(`<[^>]*>`)
+		yo := strings.NewReplacer("ё", "е", "Ё", "Е")
+		items, err := app.FindAllRecords("items")
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			description := html.UnescapeString(tagRegex.ReplaceAllString(item.GetString("description"), " "))
+			_, err := app.DB().NewQuery(
+				"INSERT INTO items_fts (item_id, title, description, tags) VALUES ({:id}, {:title}, {:description}, {:tags})",
+			).Bind(dbx.Params{
+				"id":          item.Id,
+				"title":       yo.Replace(item.GetString("title")),
+				"description": yo.Replace(strings.Join(strings.Fields(description), " ")),
+				"tags":        yo.Replace(item.GetString("tags")),
+			}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		_, err := app.DB().NewQuery("DROP TABLE IF EXISTS items_fts").Execute()
+		return err
+	})
+}
@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+
+		itemsCol.Fields.Add(
+			&core.NumberField{
+				Name: "latitude",
+				Min:  types.Pointer(-90.0),
+				Max:  types.Pointer(90.0),
+			},
+			&core.NumberField{
+				Name: "longitude",
+				Min:  types.Pointer(-180.0),
+				Max:  types.Pointer(180.0),
+			},
+		)
+		itemsCol.AddIndex("idx_items_coordinates", false, "`latitude`, `longitude`", "")
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		// coordinates for the seeded items
+		seedCoordinates := map[string][2]float64{
+			"Перфоратор Bosch GBH 2-26":      {43.2125, 76.9000},
+			"Палатка 3-местная NatureHike":   {43.2567, 76.9729},
+			"Велосипед горный Trek Marlin 7": {51.1479, 71.4770},
+			"Проектор Xiaomi Mi Smart":       {51.1280, 71.4304},
+		}
+		for title, coords := range seedCoordinates {
+			rec, _ := app.FindFirstRecordByData(itemsCol.Id, "title", title)
+			if rec == nil {
+				continue
+			}
+			rec.Set("latitude", coords[0])
+			rec.Set("longitude", coords[1])
+			if err := app.Save(rec); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+
+		itemsCol.RemoveIndex("idx_items_coordinates")
+		itemsCol.Fields.RemoveByName("latitude")
+		itemsCol.Fields.RemoveByName("longitude")
+
+		return app.Save(itemsCol)
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"uley_be/gazetteer"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+
+		itemsCol.Fields.Add(&core.TextField{
+			Name: "location_id",
+			Max:  100,
+		})
+		itemsCol.AddIndex("idx_items_location_id", false, "`location_id`", "")
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		// normalize the existing locations
+		items, err := app.FindAllRecords(itemsCol.Id)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			loc, ok := gazetteer.Resolve(item.GetString("location"))
+			if !ok {
+				continue
+			}
+			item.Set("location_id", loc.ID)
+			if err := app.Save(item); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+
+		itemsCol.RemoveIndex("idx_items_location_id")
+		itemsCol.Fields.RemoveByName("location_id")
+
+		return app.Save(itemsCol)
+	})
+}
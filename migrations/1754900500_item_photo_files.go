@@ -0,0 +1,110 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		itemPhotosCol, err := app.FindCollectionByNameOrId("item_photos")
+		if err != nil {
+			return err
+		}
+
+		// uploaded photos don't have an external url
+		if urlField, ok := itemPhotosCol.Fields.GetByName("url").(*core.URLField); ok {
+			urlField.Required = false
+		}
+
+		// older snapshots dropped the back reference to the item
+		if itemPhotosCol.Fields.GetByName("item") == nil {
+			itemsCol, err := app.FindCollectionByNameOrId("items")
+			if err != nil {
+				return err
+			}
+			itemPhotosCol.Fields.Add(&core.RelationField{
+				Name:          "item",
+				CollectionId:  itemsCol.Id,
+				MaxSelect:     1,
+				CascadeDelete: true,
+			})
+		}
+
+		itemPhotosCol.Fields.Add(
+			&core.FileField{
+				Name:      "file",
+				MaxSelect: 1,
+				MaxSize:   10 << 20,
+				MimeTypes: []string{"image/jpeg", "image/png", "image/webp"},
+			},
+			&core.FileField{
+				Name:      "thumb_sm",
+				MaxSelect: 1,
+				MaxSize:   5 << 20,
+			},
+			&core.FileField{
+				Name:      "thumb_md",
+				MaxSelect: 1,
+				MaxSize:   5 << 20,
+			},
+			&core.FileField{
+				Name:      "thumb_lg",
+				MaxSelect: 1,
+				MaxSize:   5 << 20,
+			},
+		)
+		itemPhotosCol.AddIndex("idx_item_photos_item", false, "`item`", "")
+		if err := app.Save(itemPhotosCol); err != nil {
+			return err
+		}
+
+		// items.photos is the ordered list of photos, the first one is the cover
+		items, err := app.FindAllRecords("items")
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if len(item.GetStringSlice("photos")) > 0 {
+				continue
+			}
+			photos := []*core.Record{}
+			err := app.RecordQuery(itemPhotosCol).
+				AndWhere(dbx.HashExp{"item": item.Id}).
+				OrderBy("created ASC").
+				All(&photos)
+			if err != nil {
+				return err
+			}
+			if len(photos) == 0 {
+				continue
+			}
+			ids := make([]string, len(photos))
+			for i, p := range photos {
+				ids[i] = p.Id
+			}
+			item.Set("photos", ids)
+			if err := app.Save(item); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		itemPhotosCol, err := app.FindCollectionByNameOrId("item_photos")
+		if err != nil {
+			return err
+		}
+
+		itemPhotosCol.RemoveIndex("idx_item_photos_item")
+		for _, name := range []string{"file", "thumb_sm", "thumb_md", "thumb_lg"} {
+			itemPhotosCol.Fields.RemoveByName(name)
+		}
+		if urlField, ok := itemPhotosCol.Fields.GetByName("url").(*core.URLField); ok {
+			urlField.Required = true
+		}
+
+		return app.Save(itemPhotosCol)
+	})
+}
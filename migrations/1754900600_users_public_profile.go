@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		usersCol.Fields.Add(
+			&core.NumberField{
+				Name: "rating",
+				Min:  types.Pointer(0.0),
+				Max:  types.Pointer(5.0),
+			},
+			&core.NumberField{
+				Name:    "reviews_count",
+				Min:     types.Pointer(0.0),
+				OnlyInt: true,
+			},
+		)
+
+		// the record API used to expose identity (IIN) and phone to anyone;
+		// other users get the public profile through the items endpoints
+		usersCol.ViewRule = types.Pointer("id = @request.auth.id")
+
+		return app.Save(usersCol)
+	}, func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		usersCol.Fields.RemoveByName("rating")
+		usersCol.Fields.RemoveByName("reviews_count")
+		usersCol.ViewRule = types.Pointer("")
+
+		return app.Save(usersCol)
+	})
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		rows := []struct {
+			ID   string `db:"id"`
+			Tags string `db:"tags"`
+		}{}
+		if err := app.DB().Select("id", "tags").From("items").All(&rows); err != nil {
+			return err
+		}
+
+		// same rules as services.NormalizeTags: lowercase, ё -> е,
+		// single spaces, no duplicates, joined with ", "
+		yo := strings.NewReplacer("ё", "е", "Ё", "е")
+		for _, row := range rows {
+			tags := []string{}
+			seen := map[string]bool{}
+			for _, part := range strings.Split(row.Tags, ",") {
+				tag := strings.Join(strings.Fields(yo.Replace(strings.ToLower(part))), " ")
+				if tag == "" || seen[tag] {
+					continue
+				}
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+
+			normalized := strings.Join(tags, ", ")
+			if normalized == row.Tags {
+				continue
+			}
+			_, err := app.DB().Update("items", dbx.Params{"tags": normalized}, dbx.HashExp{"id": row.ID}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// normalized tags are a valid input, nothing to undo
+		return nil
+	})
+}
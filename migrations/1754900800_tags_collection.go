@@ -0,0 +1,113 @@
+package migrations
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+
+		tagsCol := core.NewBaseCollection("tags")
+		tagsCol.ListRule = types.Pointer("")
+		tagsCol.ViewRule = types.Pointer("")
+		tagsCol.Fields.Add(
+			&core.TextField{
+				Name:     "name",
+				Required: true,
+				Max:      50,
+			},
+			&core.NumberField{
+				Name:    "usage_count",
+				Min:     types.Pointer(0.0),
+				OnlyInt: true,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		tagsCol.AddIndex("idx_tags_name", true, "`name`", "")
+		tagsCol.AddIndex("idx_tags_usage_count", false, "`usage_count`", "")
+		if err := app.Save(tagsCol); err != nil {
+			return err
+		}
+
+		itemsCol.Fields.Add(&core.RelationField{
+			Name:         "item_tags",
+			CollectionId: tagsCol.Id,
+			MaxSelect:    50,
+		})
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		// items.tags are already normalized, link them to the tag records
+		rows := []struct {
+			ID   string `db:"id"`
+			Tags string `db:"tags"`
+		}{}
+		if err := app.DB().Select("id", "tags").From("items").All(&rows); err != nil {
+			return err
+		}
+
+		tagIDs := map[string]string{}
+		for _, row := range rows {
+			ids := []string{}
+			for _, name := range strings.Split(row.Tags, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+				if _, ok := tagIDs[name]; !ok {
+					tag := core.NewRecord(tagsCol)
+					tag.Set("name", name)
+					if err := app.Save(tag); err != nil {
+						return err
+					}
+					tagIDs[name] = tag.Id
+				}
+				ids = append(ids, tagIDs[name])
+			}
+
+			raw, _ := json.Marshal(ids)
+			_, err := app.DB().Update("items", dbx.Params{"item_tags": string(raw)}, dbx.HashExp{"id": row.ID}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = app.DB().NewQuery(
+			"UPDATE tags SET usage_count = (SELECT COUNT(*) FROM items, json_each(items.item_tags) WHERE json_each.value = tags.id)",
+		).Execute()
+		return err
+	}, func(app core.App) error {
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+		itemsCol.Fields.RemoveByName("item_tags")
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		if tagsCol, _ := app.FindCollectionByNameOrId("tags"); tagsCol != nil {
+			return app.Delete(tagsCol)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,196 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		categoriesCol, err := app.FindCollectionByNameOrId("categories")
+		if err != nil {
+			return err
+		}
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+
+		categoriesCol.Fields.Add(
+			&core.RelationField{
+				Name:         "parent",
+				CollectionId: categoriesCol.Id,
+				MaxSelect:    1,
+			},
+			// [{key, type: number|text|bool|enum, label, unit, required, options, min, max}]
+			&core.JSONField{
+				Name:    "attributes",
+				MaxSize: 20000,
+			},
+		)
+		categoriesCol.AddIndex("idx_categories_parent", false, "`parent`", "")
+		if err := app.Save(categoriesCol); err != nil {
+			return err
+		}
+
+		itemsCol.Fields.Add(&core.JSONField{
+			Name:    "attributes",
+			MaxSize: 20000,
+		})
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		// attribute schemas of the seeded categories and their subcategories
+		type categorySeed struct {
+			Name       string
+			Parent     string
+			Attributes []map[string]any
+		}
+		seeds := []categorySeed{
+			{
+				Name: "Инструменты",
+				Attributes: []map[string]any{
+					{"key": "power_w", "type": "number", "label": "Мощность", "unit": "Вт", "min": 0},
+					{"key": "cordless", "type": "bool", "label": "Аккумуляторный"},
+				},
+			},
+			{
+				Name:   "Перфораторы",
+				Parent: "Инструменты",
+				Attributes: []map[string]any{
+					{"key": "impact_energy_j", "type": "number", "label": "Энергия удара", "unit": "Дж", "min": 0},
+				},
+			},
+			{
+				Name: "Электроника",
+				Attributes: []map[string]any{
+					{"key": "brand", "type": "text", "label": "Бренд"},
+				},
+			},
+			{
+				Name:   "Проекторы",
+				Parent: "Электроника",
+				Attributes: []map[string]any{
+					{"key": "resolution", "type": "enum", "label": "Разрешение", "options": []string{"720p", "1080p", "4k"}, "required": true},
+					{"key": "brightness_lm", "type": "number", "label": "Яркость", "unit": "лм", "min": 0},
+				},
+			},
+			{
+				Name:       "Спорт",
+				Attributes: []map[string]any{},
+			},
+			{
+				Name:   "Велосипеды",
+				Parent: "Спорт",
+				Attributes: []map[string]any{
+					{"key": "wheel_size", "type": "enum", "label": "Диаметр колёс", "options": []string{"24", "26", "27.5", "29"}},
+					{"key": "frame_size", "type": "enum", "label": "Размер рамы", "options": []string{"S", "M", "L", "XL"}},
+				},
+			},
+			{
+				Name: "Кемпинг",
+				Attributes: []map[string]any{
+					{"key": "weight_kg", "type": "number", "label": "Вес", "unit": "кг", "min": 0},
+				},
+			},
+			{
+				Name:   "Палатки",
+				Parent: "Кемпинг",
+				Attributes: []map[string]any{
+					{"key": "capacity", "type": "number", "label": "Вместимость", "unit": "чел.", "min": 1, "max": 20},
+				},
+			},
+		}
+
+		categories := map[string]*core.Record{}
+		for _, seed := range seeds {
+			rec, _ := app.FindFirstRecordByData(categoriesCol.Id, "name", seed.Name)
+			if rec == nil {
+				rec = core.NewRecord(categoriesCol)
+				rec.Set("name", seed.Name)
+			}
+			if seed.Parent != "" {
+				rec.Set("parent", categories[seed.Parent].Id)
+			}
+			rec.Set("attributes", seed.Attributes)
+			if err := app.Save(rec); err != nil {
+				return err
+			}
+			categories[seed.Name] = rec
+		}
+
+		// move the seeded items to the subcategories
+		type itemSeed struct {
+			Category   string
+			Attributes map[string]any
+		}
+		items := map[string]itemSeed{
+			"Перфоратор Bosch GBH 2-26": {
+				Category:   "Перфораторы",
+				Attributes: map[string]any{"power_w": 830, "cordless": false, "impact_energy_j": 2.7},
+			},
+			"Палатка 3-местная NatureHike": {
+				Category:   "Палатки",
+				Attributes: map[string]any{"capacity": 3, "weight_kg": 2.1},
+			},
+			"Велосипед горный Trek Marlin 7": {
+				Category:   "Велосипеды",
+				Attributes: map[string]any{"wheel_size": "29", "frame_size": "M"},
+			},
+			"Проектор Xiaomi Mi Smart": {
+				Category:   "Проекторы",
+				Attributes: map[string]any{"brand": "Xiaomi", "resolution": "1080p", "brightness_lm": 500},
+			},
+		}
+		for title, seed := range items {
+			raw, _ := json.Marshal(seed.Attributes)
+			_, err := app.DB().Update("items",
+				dbx.Params{"category": categories[seed.Category].Id, "attributes": string(raw)},
+				dbx.HashExp{"title": title},
+			).Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		categoriesCol, err := app.FindCollectionByNameOrId("categories")
+		if err != nil {
+			return err
+		}
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+
+		// items go back to the root categories before the subcategories are removed
+		_, err = app.DB().NewQuery(
+			"UPDATE items SET category = (SELECT COALESCE(NULLIF(parent, ''), id) FROM categories WHERE categories.id = items.category)",
+		).Execute()
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"Перфораторы", "Проекторы", "Велосипеды", "Палатки"} {
+			if rec, _ := app.FindFirstRecordByData(categoriesCol.Id, "name", name); rec != nil {
+				if err := app.Delete(rec); err != nil {
+					return err
+				}
+			}
+		}
+
+		itemsCol.Fields.RemoveByName("attributes")
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		categoriesCol.RemoveIndex("idx_categories_parent")
+		categoriesCol.Fields.RemoveByName("parent")
+		categoriesCol.Fields.RemoveByName("attributes")
+		return app.Save(categoriesCol)
+	})
+}
@@ -0,0 +1,145 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		categoriesCol, err := app.FindCollectionByNameOrId("categories")
+		if err != nil {
+			return err
+		}
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+
+		// russian stays in the plain fields, translations are optional
+		categoriesCol.Fields.Add(
+			&core.TextField{Name: "name_kk", Max: 100},
+			&core.TextField{Name: "name_en", Max: 100},
+		)
+		if err := app.Save(categoriesCol); err != nil {
+			return err
+		}
+
+		itemsCol.Fields.Add(
+			&core.TextField{Name: "title_kk", Max: 120},
+			&core.TextField{Name: "title_en", Max: 120},
+			&core.EditorField{Name: "description_kk", ConvertURLs: true},
+			&core.EditorField{Name: "description_en", ConvertURLs: true},
+		)
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		categoryNames := map[string][2]string{
+			"Инструменты": {"Құралдар", "Tools"},
+			"Перфораторы": {"Перфораторлар", "Rotary hammers"},
+			"Электроника": {"Электроника", "Electronics"},
+			"Проекторы":   {"Проекторлар", "Projectors"},
+			"Спорт":       {"Спорт", "Sports"},
+			"Велосипеды":  {"Велосипедтер", "Bikes"},
+			"Кемпинг":     {"Кемпинг", "Camping"},
+			"Палатки":     {"Шатырлар", "Tents"},
+		}
+		attributeLabels := map[string][2]string{
+			"power_w":         {"Қуаты", "Power"},
+			"cordless":        {"Аккумуляторлы", "Cordless"},
+			"impact_energy_j": {"Соққы энергиясы", "Impact energy"},
+			"brand":           {"Бренд", "Brand"},
+			"resolution":      {"Ажыратымдылық", "Resolution"},
+			"brightness_lm":   {"Жарықтығы", "Brightness"},
+			"wheel_size":      {"Дөңгелек диаметрі", "Wheel size"},
+			"frame_size":      {"Рама өлшемі", "Frame size"},
+			"weight_kg":       {"Салмағы", "Weight"},
+			"capacity":        {"Сыйымдылығы", "Capacity"},
+		}
+		for name, tr := range categoryNames {
+			rec, _ := app.FindFirstRecordByData(categoriesCol.Id, "name", name)
+			if rec == nil {
+				continue
+			}
+			rec.Set("name_kk", tr[0])
+			rec.Set("name_en", tr[1])
+
+			attributes := []map[string]any{}
+			_ = rec.UnmarshalJSONField("attributes", &attributes)
+			for _, attr := range attributes {
+				key, _ := attr["key"].(string)
+				if labels, ok := attributeLabels[key]; ok {
+					attr["labels"] = map[string]string{"kk": labels[0], "en": labels[1]}
+				}
+			}
+			rec.Set("attributes", attributes)
+
+			if err := app.Save(rec); err != nil {
+				return err
+			}
+		}
+
+		type itemTranslation struct {
+			TitleKk, TitleEn             string
+			DescriptionKk, DescriptionEn string
+		}
+		items := map[string]itemTranslation{
+			"Перфоратор Bosch GBH 2-26": {
+				TitleKk:       "Bosch GBH 2-26 перфораторы",
+				TitleEn:       "Bosch GBH 2-26 rotary hammer",
+				DescriptionKk: "Жөндеуге арналған сенімді перфоратор. Бетон мен кірпішке жарайды.",
+				DescriptionEn: "Reliable rotary hammer for renovation. Works with concrete and brick.",
+			},
+			"Палатка 3-местная NatureHike": {
+				TitleEn:       "NatureHike 3-person tent",
+				DescriptionEn: "Light and sturdy tent for weekends outdoors.",
+			},
+			"Велосипед горный Trek Marlin 7": {
+				TitleKk: "Trek Marlin 7 тау велосипеді",
+				TitleEn: "Trek Marlin 7 mountain bike",
+			},
+			"Проектор Xiaomi Mi Smart": {
+				TitleKk:       "Xiaomi Mi Smart проекторы",
+				TitleEn:       "Xiaomi Mi Smart projector",
+				DescriptionEn: "Bright projector for movies and presentations. Wi-Fi support.",
+			},
+		}
+		for title, tr := range items {
+			rec, _ := app.FindFirstRecordByData(itemsCol.Id, "title", title)
+			if rec == nil {
+				continue
+			}
+			rec.Set("title_kk", tr.TitleKk)
+			rec.Set("title_en", tr.TitleEn)
+			rec.Set("description_kk", tr.DescriptionKk)
+			rec.Set("description_en", tr.DescriptionEn)
+
+			// saved through the app so the search index picks up every language
+			if err := app.Save(rec); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		categoriesCol, err := app.FindCollectionByNameOrId("categories")
+		if err != nil {
+			return err
+		}
+		categoriesCol.Fields.RemoveByName("name_kk")
+		categoriesCol.Fields.RemoveByName("name_en")
+		if err := app.Save(categoriesCol); err != nil {
+			return err
+		}
+
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"title_kk", "title_en", "description_kk", "description_en"} {
+			itemsCol.Fields.RemoveByName(name)
+		}
+		return app.Save(itemsCol)
+	})
+}
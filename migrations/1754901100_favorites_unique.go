@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		favorites, err := app.FindCollectionByNameOrId("favorite_items")
+		if err != nil {
+			return err
+		}
+
+		// drop broken rows and doubles before the unique index
+		_, err = app.DB().NewQuery(
+			"DELETE FROM {{favorite_items}} WHERE [[user]] = '' OR [[item]] = '' OR [[rowid]] NOT IN" +
+				" (SELECT MIN([[rowid]]) FROM {{favorite_items}} GROUP BY [[user]], [[item]])",
+		).Execute()
+		if err != nil {
+			return err
+		}
+
+		for _, name := range []string{"user", "item"} {
+			if field, ok := favorites.Fields.GetByName(name).(*core.RelationField); ok {
+				field.Required = true
+			}
+		}
+		favorites.AddIndex("idx_favorite_items_user_item", true, "`user`, `item`", "")
+
+		// users manage their own favorites only
+		favorites.ListRule = types.Pointer("user = @request.auth.id")
+		favorites.ViewRule = types.Pointer("user = @request.auth.id")
+		favorites.CreateRule = types.Pointer("@request.auth.id != '' && user = @request.auth.id")
+		favorites.DeleteRule = types.Pointer("user = @request.auth.id")
+
+		return app.Save(favorites)
+	}, func(app core.App) error {
+		favorites, err := app.FindCollectionByNameOrId("favorite_items")
+		if err != nil {
+			return err
+		}
+
+		for _, name := range []string{"user", "item"} {
+			if field, ok := favorites.Fields.GetByName(name).(*core.RelationField); ok {
+				field.Required = false
+			}
+		}
+		favorites.RemoveIndex("idx_favorite_items_user_item")
+		favorites.ListRule = nil
+		favorites.ViewRule = nil
+		favorites.CreateRule = nil
+		favorites.DeleteRule = nil
+
+		return app.Save(favorites)
+	})
+}
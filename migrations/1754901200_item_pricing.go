@@ -0,0 +1,107 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+
+		// price stays as the daily equivalent used by sorting and filters
+		itemsCol.Fields.Add(
+			&core.NumberField{Name: "price_hourly", Min: types.Pointer(0.0)},
+			&core.NumberField{Name: "price_daily", Min: types.Pointer(0.0)},
+			&core.NumberField{Name: "price_weekly", Min: types.Pointer(0.0)},
+			&core.NumberField{Name: "price_monthly", Min: types.Pointer(0.0)},
+			&core.NumberField{Name: "deposit", Min: types.Pointer(0.0)},
+			// 0 means no limit
+			&core.NumberField{Name: "min_rental_hours", Min: types.Pointer(0.0), OnlyInt: true},
+			&core.NumberField{Name: "max_rental_hours", Min: types.Pointer(0.0), OnlyInt: true},
+		)
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		// the price of a rent is fixed when it is requested
+		rentsCol.Fields.Add(
+			&core.NumberField{Name: "amount", Min: types.Pointer(0.0)},
+			&core.NumberField{Name: "deposit", Min: types.Pointer(0.0)},
+			&core.JSONField{Name: "quote", MaxSize: 20000},
+		)
+		if err := app.Save(rentsCol); err != nil {
+			return err
+		}
+
+		// the old price was per day
+		_, err = app.DB().NewQuery("UPDATE {{items}} SET [[price_daily]] = [[price]]").Execute()
+		if err != nil {
+			return err
+		}
+
+		type pricingSeed struct {
+			Weekly, Monthly, Deposit float64
+			MinHours                 int
+		}
+		seeds := map[string]pricingSeed{
+			"Перфоратор Bosch GBH 2-26":      {Weekly: 45000, Deposit: 30000, MinHours: 24},
+			"Палатка 3-местная NatureHike":   {Weekly: 30000, Deposit: 20000, MinHours: 24},
+			"Велосипед горный Trek Marlin 7": {Weekly: 55000, Monthly: 180000, Deposit: 100000},
+			"Проектор Xiaomi Mi Smart":       {Weekly: 80000, Deposit: 150000, MinHours: 24},
+		}
+		for title, seed := range seeds {
+			_, err := app.DB().Update("items", dbx.Params{
+				"price_weekly":     seed.Weekly,
+				"price_monthly":    seed.Monthly,
+				"deposit":          seed.Deposit,
+				"min_rental_hours": seed.MinHours,
+			}, dbx.HashExp{"title": title}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		// existing rents are priced by the day
+		_, err = app.DB().NewQuery(
+			"UPDATE {{rents}} SET" +
+				" [[amount]] = (SELECT [[price]] FROM {{items}} WHERE [[items.id]] = [[rents.item]])" +
+				" * MAX(1, CAST(julianday([[date_end]]) - julianday([[date_start]]) + 0.999 AS INTEGER))," +
+				" [[deposit]] = (SELECT [[deposit]] FROM {{items}} WHERE [[items.id]] = [[rents.item]])",
+		).Execute()
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(app core.App) error {
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"price_hourly", "price_daily", "price_weekly", "price_monthly", "deposit", "min_rental_hours", "max_rental_hours"} {
+			itemsCol.Fields.RemoveByName(name)
+		}
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"amount", "deposit", "quote"} {
+			rentsCol.Fields.RemoveByName(name)
+		}
+		return app.Save(rentsCol)
+	})
+}
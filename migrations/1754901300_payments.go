@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+
+		// derived from the payments records
+		rentsCol.Fields.Add(
+			&core.SelectField{
+				Name:      "payment_status",
+				MaxSelect: 1,
+				Values:    []string{"unpaid", "pending", "authorized", "paid", "failed", "refunded", "partially_refunded"},
+			},
+			&core.SelectField{
+				Name:      "deposit_status",
+				MaxSelect: 1,
+				Values:    []string{"none", "pending", "held", "released", "failed"},
+			},
+		)
+		if err := app.Save(rentsCol); err != nil {
+			return err
+		}
+		_, err = app.DB().NewQuery("UPDATE {{rents}} SET [[payment_status]] = 'unpaid', [[deposit_status]] = 'none'").Execute()
+		if err != nil {
+			return err
+		}
+
+		payments := core.NewBaseCollection("payments")
+		// only the rent parties see the payments, changes go through the v2 API
+		payments.ListRule = types.Pointer("rent.renter = @request.auth.id || rent.item.author = @request.auth.id")
+		payments.ViewRule = types.Pointer("rent.renter = @request.auth.id || rent.item.author = @request.auth.id")
+		payments.Fields.Add(
+			&core.RelationField{
+				Name:         "rent",
+				CollectionId: rentsCol.Id,
+				MaxSelect:    1,
+				Required:     true,
+			},
+			&core.SelectField{
+				Name:      "kind",
+				MaxSelect: 1,
+				Required:  true,
+				Values:    []string{"charge", "deposit", "refund"},
+			},
+			&core.SelectField{
+				Name:      "status",
+				MaxSelect: 1,
+				Required:  true,
+				Values:    []string{"pending", "authorized", "captured", "failed", "succeeded", "held", "released"},
+			},
+			&core.TextField{Name: "provider", Required: true, Max: 50},
+			&core.TextField{Name: "provider_id", Required: true, Max: 255},
+			&core.NumberField{Name: "amount", Min: types.Pointer(0.0)},
+			&core.TextField{Name: "currency", Max: 3},
+			// may be relative to the API for the fake provider
+			&core.TextField{Name: "checkout_url", Max: 2000},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		if err := app.Save(payments); err != nil {
+			return err
+		}
+
+		// refunds point to the charge they return
+		payments.Fields.Add(&core.RelationField{
+			Name:         "parent",
+			CollectionId: payments.Id,
+			MaxSelect:    1,
+		})
+		payments.AddIndex("idx_payments_provider_id", true, "`provider`, `provider_id`", "")
+		payments.AddIndex("idx_payments_rent", false, "`rent`, `kind`", "")
+
+		return app.Save(payments)
+	}, func(app core.App) error {
+		payments, err := app.FindCollectionByNameOrId("payments")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(payments); err != nil {
+			return err
+		}
+
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+		rentsCol.Fields.RemoveByName("payment_status")
+		rentsCol.Fields.RemoveByName("deposit_status")
+		return app.Save(rentsCol)
+	})
+}
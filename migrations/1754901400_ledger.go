@@ -0,0 +1,87 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// the ledger is written by the server only, owners read their
+		// balance through the v2 API
+		entries := core.NewBaseCollection("ledger_entries")
+		entries.Fields.Add(
+			&core.RelationField{
+				Name:         "rent",
+				CollectionId: rentsCol.Id,
+				MaxSelect:    1,
+			},
+			&core.SelectField{
+				Name:      "kind",
+				MaxSelect: 1,
+				Required:  true,
+				Values:    []string{"charge", "refund", "deposit_held", "deposit_released"},
+			},
+			// what the entry was posted for, e.g. "charge:<payment id>"
+			&core.TextField{Name: "reference", Required: true, Max: 255},
+			&core.TextField{Name: "memo", Max: 255},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		entries.AddIndex("idx_ledger_entries_reference", true, "`reference`", "")
+		entries.AddIndex("idx_ledger_entries_rent", false, "`rent`", "")
+		if err := app.Save(entries); err != nil {
+			return err
+		}
+
+		lines := core.NewBaseCollection("ledger_lines")
+		lines.Fields.Add(
+			&core.RelationField{
+				Name:          "entry",
+				CollectionId:  entries.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.SelectField{
+				Name:      "account",
+				MaxSelect: 1,
+				Required:  true,
+				Values:    []string{"cash", "commission", "owner_payable", "deposit_holds", "renter_deposits"},
+			},
+			// set on the owner_payable lines
+			&core.RelationField{
+				Name:         "owner",
+				CollectionId: usersCol.Id,
+				MaxSelect:    1,
+			},
+			&core.NumberField{Name: "debit", Min: types.Pointer(0.0)},
+			&core.NumberField{Name: "credit", Min: types.Pointer(0.0)},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		lines.AddIndex("idx_ledger_lines_entry", false, "`entry`", "")
+		lines.AddIndex("idx_ledger_lines_account_owner", false, "`account`, `owner`", "")
+
+		return app.Save(lines)
+	}, func(app core.App) error {
+		for _, name := range []string{"ledger_lines", "ledger_entries"} {
+			col, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(col); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
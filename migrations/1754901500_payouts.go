@@ -0,0 +1,143 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// where the owner gets paid; users see and edit only their own record
+		usersCol.Fields.Add(&core.TextField{
+			Name:    "payout_iban",
+			Pattern: `^KZ[0-9]{2}[0-9A-Z]{16}$`,
+		})
+		if err := app.Save(usersCol); err != nil {
+			return err
+		}
+
+		// batches are managed by superusers only
+		batches := core.NewBaseCollection("payout_batches")
+		batches.Fields.Add(
+			&core.SelectField{
+				Name:      "status",
+				MaxSelect: 1,
+				Required:  true,
+				Values:    []string{"pending", "exported", "paid"},
+			},
+			&core.NumberField{Name: "total", Min: types.Pointer(0.0)},
+			&core.NumberField{Name: "payouts_count", Min: types.Pointer(0.0), OnlyInt: true},
+			&core.DateField{Name: "exported_at"},
+			&core.DateField{Name: "paid_at"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		if err := app.Save(batches); err != nil {
+			return err
+		}
+
+		payouts := core.NewBaseCollection("payouts")
+		payouts.Fields.Add(
+			&core.RelationField{
+				Name:          "batch",
+				CollectionId:  batches.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:         "owner",
+				CollectionId: usersCol.Id,
+				MaxSelect:    1,
+				Required:     true,
+			},
+			&core.NumberField{Name: "amount", Min: types.Pointer(0.0)},
+			&core.TextField{Name: "currency", Max: 3},
+			// the account at the time of the batch
+			&core.TextField{Name: "iban", Max: 34},
+			&core.SelectField{
+				Name:      "status",
+				MaxSelect: 1,
+				Required:  true,
+				Values:    []string{"pending", "exported", "paid"},
+			},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		payouts.AddIndex("idx_payouts_batch", false, "`batch`", "")
+		payouts.AddIndex("idx_payouts_owner", false, "`owner`", "")
+		payouts.ListRule = types.Pointer("owner = @request.auth.id")
+		payouts.ViewRule = types.Pointer("owner = @request.auth.id")
+		if err := app.Save(payouts); err != nil {
+			return err
+		}
+
+		entries, err := app.FindCollectionByNameOrId("ledger_entries")
+		if err != nil {
+			return err
+		}
+		kind, _ := entries.Fields.GetByName("kind").(*core.SelectField)
+		kind.Values = append(kind.Values, "payout")
+		if err := app.Save(entries); err != nil {
+			return err
+		}
+
+		// owner_payable lines taken into a payout
+		lines, err := app.FindCollectionByNameOrId("ledger_lines")
+		if err != nil {
+			return err
+		}
+		lines.Fields.Add(&core.RelationField{
+			Name:         "payout",
+			CollectionId: payouts.Id,
+			MaxSelect:    1,
+		})
+		lines.AddIndex("idx_ledger_lines_payout", false, "`payout`", "")
+
+		return app.Save(lines)
+	}, func(app core.App) error {
+		lines, err := app.FindCollectionByNameOrId("ledger_lines")
+		if err != nil {
+			return err
+		}
+		lines.RemoveIndex("idx_ledger_lines_payout")
+		lines.Fields.RemoveByName("payout")
+		if err := app.Save(lines); err != nil {
+			return err
+		}
+
+		entries, err := app.FindCollectionByNameOrId("ledger_entries")
+		if err != nil {
+			return err
+		}
+		kind, _ := entries.Fields.GetByName("kind").(*core.SelectField)
+		kind.Values = []string{"charge", "refund", "deposit_held", "deposit_released"}
+		if err := app.Save(entries); err != nil {
+			return err
+		}
+
+		for _, name := range []string{"payouts", "payout_batches"} {
+			col, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(col); err != nil {
+				return err
+			}
+		}
+
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		usersCol.Fields.RemoveByName("payout_iban")
+
+		return app.Save(usersCol)
+	})
+}
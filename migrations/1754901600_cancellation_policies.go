@@ -0,0 +1,97 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+var cancellationPolicies = []string{"flexible", "moderate", "strict"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		itemsCol, err := app.FindCollectionByNameOrId("items")
+		if err != nil {
+			return err
+		}
+		itemsCol.Fields.Add(&core.SelectField{
+			Name:      "cancellation_policy",
+			MaxSelect: 1,
+			Values:    cancellationPolicies,
+		})
+		if err := app.Save(itemsCol); err != nil {
+			return err
+		}
+
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+		rentsCol.Fields.Add(
+			// the policy of the item when the rent was booked
+			&core.SelectField{
+				Name:      "cancellation_policy",
+				MaxSelect: 1,
+				Values:    cancellationPolicies,
+			},
+			// the refund breakdown, set when the rent is cancelled
+			&core.JSONField{Name: "cancellation", MaxSize: 4096},
+		)
+		if err := app.Save(rentsCol); err != nil {
+			return err
+		}
+
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		usersCol.Fields.Add(&core.NumberField{
+			Name:    "owner_cancellations_count",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		})
+		if err := app.Save(usersCol); err != nil {
+			return err
+		}
+
+		_, err = app.DB().Update("items", dbx.Params{"cancellation_policy": "flexible"}, nil).Execute()
+		if err != nil {
+			return err
+		}
+		// the expensive seeded items
+		_, err = app.DB().Update("items", dbx.Params{"cancellation_policy": "moderate"}, dbx.In("title",
+			"Перфоратор Bosch GBH 2-26",
+			"Велосипед горный Trek Marlin 7",
+			"Проектор Xiaomi Mi Smart",
+		)).Execute()
+		if err != nil {
+			return err
+		}
+
+		_, err = app.DB().NewQuery(
+			"UPDATE {{rents}} SET [[cancellation_policy]] = " +
+				"COALESCE((SELECT [[cancellation_policy]] FROM {{items}} WHERE [[items.id]] = [[rents.item]]), 'flexible')",
+		).Execute()
+		return err
+	}, func(app core.App) error {
+		fields := map[string][]string{
+			"items": {"cancellation_policy"},
+			"rents": {"cancellation_policy", "cancellation"},
+			"users": {"owner_cancellations_count"},
+		}
+		for name, names := range fields {
+			col, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			for _, field := range names {
+				col.Fields.RemoveByName(field)
+			}
+			if err := app.Save(col); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
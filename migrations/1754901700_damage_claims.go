@@ -0,0 +1,114 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// until when the owner may claim damage, set on return
+		rentsCol.Fields.Add(&core.DateField{Name: "claim_deadline"})
+		rentsCol.AddIndex("idx_rents_claim_deadline", false, "`claim_deadline`", "")
+		if err := app.Save(rentsCol); err != nil {
+			return err
+		}
+
+		claims := core.NewBaseCollection("damage_claims")
+		claims.Fields.Add(
+			&core.RelationField{
+				Name:          "rent",
+				CollectionId:  rentsCol.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:         "owner",
+				CollectionId: usersCol.Id,
+				MaxSelect:    1,
+				Required:     true,
+			},
+			&core.RelationField{
+				Name:         "renter",
+				CollectionId: usersCol.Id,
+				MaxSelect:    1,
+				Required:     true,
+			},
+			&core.NumberField{Name: "amount", Min: types.Pointer(0.0)},
+			&core.TextField{Name: "description", Required: true, Max: 2000},
+			// served with a file token to the rent parties only
+			&core.FileField{
+				Name:      "photos",
+				Protected: true,
+				MaxSelect: 10,
+				MaxSize:   10 << 20,
+				MimeTypes: []string{"image/jpeg", "image/png", "image/webp"},
+			},
+			&core.SelectField{
+				Name:      "status",
+				MaxSelect: 1,
+				Required:  true,
+				Values:    []string{"open", "accepted", "contested", "resolved"},
+			},
+			// the renter's answer and the support's decision
+			&core.TextField{Name: "response", Max: 2000},
+			&core.TextField{Name: "resolution", Max: 2000},
+			// what was taken from the deposit
+			&core.NumberField{Name: "charged_amount", Min: types.Pointer(0.0)},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		claims.AddIndex("idx_damage_claims_rent", true, "`rent`", "")
+		claims.ListRule = types.Pointer("owner = @request.auth.id || renter = @request.auth.id")
+		claims.ViewRule = types.Pointer("owner = @request.auth.id || renter = @request.auth.id")
+		if err := app.Save(claims); err != nil {
+			return err
+		}
+
+		entries, err := app.FindCollectionByNameOrId("ledger_entries")
+		if err != nil {
+			return err
+		}
+		kind, _ := entries.Fields.GetByName("kind").(*core.SelectField)
+		kind.Values = append(kind.Values, "damage")
+		return app.Save(entries)
+	}, func(app core.App) error {
+		entries, err := app.FindCollectionByNameOrId("ledger_entries")
+		if err != nil {
+			return err
+		}
+		kind, _ := entries.Fields.GetByName("kind").(*core.SelectField)
+		kind.Values = []string{"charge", "refund", "deposit_held", "deposit_released", "payout"}
+		if err := app.Save(entries); err != nil {
+			return err
+		}
+
+		claims, err := app.FindCollectionByNameOrId("damage_claims")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(claims); err != nil {
+			return err
+		}
+
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+		rentsCol.RemoveIndex("idx_rents_claim_deadline")
+		rentsCol.Fields.RemoveByName("claim_deadline")
+
+		return app.Save(rentsCol)
+	})
+}
@@ -0,0 +1,114 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		rentsCol.Fields.Add(
+			&core.DateField{Name: "handed_over_at"},
+			&core.DateField{Name: "returned_at"},
+		)
+		if err := app.Save(rentsCol); err != nil {
+			return err
+		}
+		// from the status history of the existing rents
+		for field, status := range map[string]string{"handed_over_at": "handed_over", "returned_at": "returned"} {
+			_, err := app.DB().NewQuery(
+				"UPDATE {{rents}} SET [[" + field + "]] = COALESCE((" +
+					"SELECT MIN([[h.created]]) FROM {{rent_status_history}} h" +
+					" INNER JOIN {{statuses}} s ON [[s.id]] = [[h.to_status]]" +
+					" WHERE [[h.rent]] = [[rents.id]] AND [[s.name]] = {:status}), '')",
+			).Bind(dbx.Params{"status": status}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		// the condition of the item at pickup and return, the owner fills it
+		// in and the renter confirms it by scanning the owner's QR code
+		checkins := core.NewBaseCollection("rent_checkins")
+		checkins.Fields.Add(
+			&core.RelationField{
+				Name:          "rent",
+				CollectionId:  rentsCol.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.SelectField{
+				Name:      "kind",
+				MaxSelect: 1,
+				Required:  true,
+				Values:    []string{"handover", "return"},
+			},
+			&core.JSONField{Name: "checklist", MaxSize: 16384},
+			&core.FileField{
+				Name:      "photos",
+				Protected: true,
+				MaxSelect: 10,
+				MaxSize:   10 << 20,
+				MimeTypes: []string{"image/jpeg", "image/png", "image/webp"},
+			},
+			// e.g. the lamp hours of a projector
+			&core.NumberField{Name: "meter_reading", Min: types.Pointer(0.0)},
+			&core.TextField{Name: "meter_label", Max: 50},
+			&core.TextField{Name: "note", Max: 2000},
+			&core.RelationField{
+				Name:         "created_by",
+				CollectionId: usersCol.Id,
+				MaxSelect:    1,
+			},
+			&core.SelectField{
+				Name:      "status",
+				MaxSelect: 1,
+				Required:  true,
+				Values:    []string{"pending", "confirmed"},
+			},
+			&core.RelationField{
+				Name:         "confirmed_by",
+				CollectionId: usersCol.Id,
+				MaxSelect:    1,
+			},
+			&core.DateField{Name: "confirmed_at"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		checkins.AddIndex("idx_rent_checkins_rent_kind", true, "`rent`, `kind`", "")
+		rule := "rent.renter = @request.auth.id || rent.item.author = @request.auth.id"
+		checkins.ListRule = types.Pointer(rule)
+		checkins.ViewRule = types.Pointer(rule)
+
+		return app.Save(checkins)
+	}, func(app core.App) error {
+		checkins, err := app.FindCollectionByNameOrId("rent_checkins")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(checkins); err != nil {
+			return err
+		}
+
+		rentsCol, err := app.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+		rentsCol.Fields.RemoveByName("handed_over_at")
+		rentsCol.Fields.RemoveByName("returned_at")
+
+		return app.Save(rentsCol)
+	})
+}
@@ -0,0 +1,103 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+const (
+	FakeName = "fake"
+
+	fakeIntentPrefix  = "fake_pi_"
+	fakeDepositPrefix = "fake_dh_"
+	fakeRefundPrefix  = "fake_re_"
+)
+
+// FakeCheckoutURL is where the fake provider sends the payer, a POST there
+// confirms (or with ?outcome=fail declines) the intent.
+const FakeCheckoutURL = "/api/collections/v2/payments/fake/%s/confirm"
+
+// FakeProvider approves everything without moving money, for development
+// and tests. Charges and holds wait for the fake checkout, the rest
+// succeeds immediately.
+type FakeProvider struct {
+	secret string
+}
+
+func NewFakeProvider(secret string) *FakeProvider {
+	return &FakeProvider{secret: secret}
+}
+
+func (p *FakeProvider) Name() string {
+	return FakeName
+}
+
+func fakeID(prefix string) string {
+	return prefix + security.RandomStringWithAlphabet(16, "abcdefghijklmnopqrstuvwxyz0123456789")
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, req IntentRequest) (Intent, error) {
+	id := fakeID(fakeIntentPrefix)
+	return Intent{
+		ID:          id,
+		Status:      StatusPending,
+		Amount:      req.Amount,
+		CheckoutURL: fmt.Sprintf(FakeCheckoutURL, id),
+	}, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, intentID string, amount float64) (Intent, error) {
+	return Intent{ID: intentID, Status: StatusCaptured, Amount: amount}, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, intentID string, amount float64) (Refund, error) {
+	return Refund{
+		ID:       fakeID(fakeRefundPrefix),
+		IntentID: intentID,
+		Status:   StatusSucceeded,
+		Amount:   amount,
+	}, nil
+}
+
+func (p *FakeProvider) HoldDeposit(ctx context.Context, req IntentRequest) (Intent, error) {
+	id := fakeID(fakeDepositPrefix)
+	return Intent{
+		ID:          id,
+		Status:      StatusPending,
+		Amount:      req.Amount,
+		CheckoutURL: fmt.Sprintf(FakeCheckoutURL, id),
+	}, nil
+}
+
+func (p *FakeProvider) ReleaseDeposit(ctx context.Context, holdID string) (Intent, error) {
+	return Intent{ID: holdID, Status: StatusReleased}, nil
+}
+
+func (p *FakeProvider) ParseWebhook(payload []byte, header http.Header) (Event, error) {
+	if err := Verify(p.secret, payload, header.Get(SignatureHeader), time.Now()); err != nil {
+		return Event{}, err
+	}
+	event := Event{}
+	if err := json.Unmarshal(payload, &event); err != nil || event.Type == "" || event.ObjectID == "" {
+		return Event{}, ErrInvalidEvent
+	}
+	return event, nil
+}
+
+// Webhook builds the signed webhook the fake checkout delivers.
+func (p *FakeProvider) Webhook(eventType, objectID string, amount float64) ([]byte, http.Header) {
+	payload, _ := json.Marshal(Event{
+		ID:       fakeID("fake_evt_"),
+		Type:     eventType,
+		ObjectID: objectID,
+		Amount:   amount,
+	})
+	header := http.Header{}
+	header.Set(SignatureHeader, Sign(p.secret, payload, time.Now()))
+	return payload, header
+}
@@ -0,0 +1,109 @@
+// Package payments abstracts the payment provider behind the rent money
+// flow: charging the rent, holding the deposit and refunds.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Statuses of provider objects, also used by the payments collection.
+const (
+	StatusPending    = "pending"
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusFailed     = "failed"
+	StatusSucceeded  = "succeeded"
+	StatusHeld       = "held"
+	StatusReleased   = "released"
+)
+
+// Webhook event types.
+const (
+	EventAuthorized      = "payment.authorized"
+	EventCaptured        = "payment.captured"
+	EventFailed          = "payment.failed"
+	EventRefunded        = "refund.succeeded"
+	EventDepositHeld     = "deposit.held"
+	EventDepositReleased = "deposit.released"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidEvent     = errors.New("invalid webhook event")
+)
+
+// IntentRequest asks to charge or hold Amount for the rent Reference.
+type IntentRequest struct {
+	Reference   string
+	Amount      float64
+	Currency    string
+	Description string
+}
+
+// Intent is a charge or a deposit hold at the provider. CheckoutURL is
+// where the payer confirms it, empty when no action is needed.
+type Intent struct {
+	ID          string
+	Status      string
+	Amount      float64
+	CheckoutURL string
+}
+
+type Refund struct {
+	ID       string
+	IntentID string
+	Status   string
+	Amount   float64
+}
+
+// Event is a verified webhook notification about ObjectID.
+type Event struct {
+	ID       string  `json:"id"`
+	Type     string  `json:"type"`
+	ObjectID string  `json:"object_id"`
+	Amount   float64 `json:"amount,omitempty"`
+}
+
+// PaymentProvider is implemented by every payment backend.
+type PaymentProvider interface {
+	Name() string
+
+	// CreateIntent authorizes the rent charge, it is captured later.
+	CreateIntent(ctx context.Context, req IntentRequest) (Intent, error)
+	// Capture takes amount of an authorized intent or a held deposit.
+	Capture(ctx context.Context, intentID string, amount float64) (Intent, error)
+	// Refund returns amount of a captured intent, or voids an authorized one.
+	Refund(ctx context.Context, intentID string, amount float64) (Refund, error)
+
+	HoldDeposit(ctx context.Context, req IntentRequest) (Intent, error)
+	// ReleaseDeposit frees what is left of the hold.
+	ReleaseDeposit(ctx context.Context, holdID string) (Intent, error)
+
+	// ParseWebhook verifies the signature of a webhook request and decodes it.
+	ParseWebhook(payload []byte, header http.Header) (Event, error)
+}
+
+// FromEnv returns the provider chosen by PAYMENT_PROVIDER, signing webhooks
+// with PAYMENT_WEBHOOK_SECRET. Without PAYMENT_PROVIDER it returns nil and
+// payments stay disabled, even the fake provider is never picked by default.
+func FromEnv() (PaymentProvider, error) {
+	name := os.Getenv("PAYMENT_PROVIDER")
+	if name == "" {
+		return nil, nil
+	}
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, errors.New("PAYMENT_WEBHOOK_SECRET is not set")
+	}
+
+	switch name {
+	case FakeName:
+		return NewFakeProvider(secret), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
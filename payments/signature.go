@@ -0,0 +1,54 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries "t=<unix time>,v1=<hex hmac-sha256 of "t.payload">".
+const SignatureHeader = "X-Uley-Signature"
+
+// signatureTolerance limits replays of old webhooks.
+const signatureTolerance = 5 * time.Minute
+
+func signature(secret string, t int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(t, 10) + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the signature header value of payload.
+func Sign(secret string, payload []byte, at time.Time) string {
+	t := at.Unix()
+	return "t=" + strconv.FormatInt(t, 10) + ",v1=" + signature(secret, t, payload)
+}
+
+// Verify checks the signature header of payload against secret.
+func Verify(secret string, payload []byte, header string, now time.Time) error {
+	var t int64
+	var sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			sig = value
+		}
+	}
+	if t == 0 || sig == "" {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(t, 0)); d > signatureTolerance || d < -signatureTolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, t, payload))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
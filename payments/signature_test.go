@@ -0,0 +1,48 @@
+package payments
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "test-secret"
+	payload := []byte(`{"id":"pay_1","status":"succeeded"}`)
+	now := time.Unix(1_760_000_000, 0)
+	valid := Sign(secret, payload, now)
+
+	scenarios := []struct {
+		name    string
+		secret  string
+		payload []byte
+		header  string
+		now     time.Time
+		valid   bool
+	}{
+		{"valid", secret, payload, valid, now, true},
+		{"valid with spaces", secret, payload, "t=" + strconv.FormatInt(now.Unix(), 10) + ", v1=" + signature(secret, now.Unix(), payload), now, true},
+		{"within tolerance", secret, payload, valid, now.Add(signatureTolerance), true},
+		{"too old", secret, payload, valid, now.Add(signatureTolerance + time.Second), false},
+		{"from the future", secret, payload, valid, now.Add(-signatureTolerance - time.Second), false},
+		{"wrong secret", "other-secret", payload, valid, now, false},
+		{"changed payload", secret, []byte(`{"id":"pay_1","status":"failed"}`), valid, now, false},
+		{"empty header", secret, payload, "", now, false},
+		{"missing time", secret, payload, "v1=" + signature(secret, now.Unix(), payload), now, false},
+		{"missing signature", secret, payload, "t=" + strconv.FormatInt(now.Unix(), 10), now, false},
+		{"invalid time", secret, payload, "t=abc,v1=" + signature(secret, now.Unix(), payload), now, false},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			err := Verify(s.secret, s.payload, s.header, s.now)
+			if s.valid && err != nil {
+				t.Fatalf("Expected a valid signature, got %v", err)
+			}
+			if !s.valid && !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("Expected ErrInvalidSignature, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Package pdf writes simple text documents: lines and table rows in the
+// standard Courier fonts on A4 pages. The standard fonts only cover Latin
+// text, Cyrillic is transliterated.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points.
+const (
+	PageWidth  = 595.0
+	PageHeight = 842.0
+	Margin     = 50.0
+)
+
+// courierAdvance is the width of every Courier glyph per point of size.
+const courierAdvance = 0.6
+
+// Column is a cell of a table row. X is the left edge of the column, Width
+// is used to right align the text.
+type Column struct {
+	X     float64
+	Width float64
+	Text  string
+	Right bool
+}
+
+// Document collects the content of the pages.
+type Document struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func New() *Document {
+	d := &Document{}
+	d.newPage()
+	return d
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = PageHeight - Margin
+}
+
+// advance moves down by the line height of size, starting a new page when
+// the line doesn't fit.
+func (d *Document) advance(size float64) {
+	height := size * 1.4
+	if d.y-height < Margin {
+		d.newPage()
+	}
+	d.y -= height
+}
+
+func (d *Document) put(x, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, d.y, escape(text))
+}
+
+// Text writes a line at the left margin.
+func (d *Document) Text(size float64, bold bool, text string) {
+	d.advance(size)
+	d.put(Margin, size, bold, Latin(text))
+}
+
+// Row writes a table row, texts longer than their column are cut.
+func (d *Document) Row(size float64, bold bool, columns ...Column) {
+	d.advance(size)
+	for _, c := range columns {
+		text := []rune(Latin(c.Text))
+		x := c.X
+		if c.Width > 0 {
+			fits := int(c.Width / (size * courierAdvance))
+			if len(text) > fits {
+				text = text[:fits]
+			}
+			if c.Right {
+				x += c.Width - float64(len(text))*size*courierAdvance
+			}
+		}
+		d.put(x, size, bold, string(text))
+	}
+}
+
+// Space leaves an empty gap of height points.
+func (d *Document) Space(height float64) {
+	if d.y-height < Margin {
+		d.newPage()
+		return
+	}
+	d.y -= height
+}
+
+// Bytes assembles the PDF file.
+func (d *Document) Bytes() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // the page tree, once the page ids are known
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+	}
+	kids := []string{}
+	for _, page := range d.pages {
+		content := len(objects) + 1
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+		objects = append(objects, fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, content,
+		))
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objects)))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	out := &bytes.Buffer{}
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return out.Bytes()
+}
+
+// escape quotes a string for a PDF literal.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
+
+// translit maps the Russian and Kazakh letters to Latin ones.
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'ә': "a", 'ғ': "g", 'қ': "q", 'ң': "n", 'ө': "o", 'ұ': "u", 'ү': "u",
+	'һ': "h", 'і': "i",
+}
+
+// Latin transliterates Cyrillic and replaces the other characters Courier
+// can't show.
+func Latin(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x80 {
+			b.WriteRune(r)
+			continue
+		}
+		lower := []rune(strings.ToLower(string(r)))[0]
+		latin, ok := translit[lower]
+		switch {
+		case !ok:
+			b.WriteByte('?')
+		case lower != r && latin != "":
+			b.WriteString(strings.ToUpper(latin[:1]) + latin[1:])
+		default:
+			b.WriteString(latin)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,27 @@
+package router
+
+import (
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func registerCategoryRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/collections/v2/categories", func(e *core.RequestEvent) error {
+		tree, err := services.CategoryTree(e.App, requestLang(e))
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"items": tree})
+	})
+
+	se.Router.GET("/api/collections/v2/categories/{id}", func(e *core.RequestEvent) error {
+		category, err := services.GetCategory(e.App, e.Request.PathValue("id"), requestLang(e))
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, category)
+	})
+}
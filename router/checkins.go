@@ -0,0 +1,86 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+type checkinConfirmBody struct {
+	Code string `json:"code"`
+}
+
+func registerCheckinRoutes(se *core.ServeEvent) {
+	// multipart: kind, checklist (a JSON array), meter_reading, meter_label,
+	// note and the photos files
+	se.Router.POST("/api/collections/v2/rents/{id}/checkins", func(e *core.RequestEvent) error {
+		var in services.CheckinInput
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+		files, err := e.FindUploadedFiles("photos")
+		if err != nil && !errors.Is(err, http.ErrMissingFile) {
+			return apiError(e, &bodyError{err})
+		}
+
+		checkin, err := services.CreateCheckin(e.App, e.Request.PathValue("id"), e.Auth.Id, in, files)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(201, checkin)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.GET("/api/collections/v2/rents/{id}/checkins", func(e *core.RequestEvent) error {
+		list, err := services.RentCheckins(e.App, e.Request.PathValue("id"), e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"items": list})
+	}).Bind(apis.RequireAuth("users"))
+
+	// a fresh code for the owner's screen, as text or as a PNG image
+	se.Router.GET("/api/collections/v2/checkins/{id}/qr", func(e *core.RequestEvent) error {
+		q := parseQuery(e.Request.URL.Query(), "format", "lang")
+		format := q.OneOf("format", "json", "json", "png")
+		if err := q.Err(); err != nil {
+			return apiError(e, err)
+		}
+
+		code, err := services.CheckinQRCode(e.App, e.Request.PathValue("id"), e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+		if format == "json" {
+			return e.JSON(200, code)
+		}
+
+		png, err := qrcode.Encode(code.Code, qrcode.Medium, 256)
+		if err != nil {
+			return apiError(e, err)
+		}
+		e.Response.Header().Set("Cache-Control", "no-store")
+		return e.Blob(200, "image/png", png)
+	}).Bind(apis.RequireAuth("users"))
+
+	// the renter scanned the owner's code
+	se.Router.POST("/api/collections/v2/checkins/confirm", func(e *core.RequestEvent) error {
+		var body checkinConfirmBody
+		if err := e.BindBody(&body); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		result, err := services.ConfirmCheckin(e.App, body.Code, e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, result)
+	}).Bind(apis.RequireAuth("users"))
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func registerDamageClaimRoutes(se *core.ServeEvent) {
+	// multipart: amount, description and the photos files
+	se.Router.POST("/api/collections/v2/rents/{id}/damage-claim", func(e *core.RequestEvent) error {
+		var in services.DamageClaimInput
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+		files, err := e.FindUploadedFiles("photos")
+		if err != nil && !errors.Is(err, http.ErrMissingFile) {
+			return apiError(e, &bodyError{err})
+		}
+
+		claim, err := services.FileDamageClaim(e.App, e.Request.PathValue("id"), e.Auth.Id, in, files)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(201, claim)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.GET("/api/collections/v2/rents/{id}/damage-claim", func(e *core.RequestEvent) error {
+		claim, err := services.GetRentDamageClaim(e.App, e.Request.PathValue("id"), e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, claim)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.POST("/api/collections/v2/damage-claims/{id}/respond", func(e *core.RequestEvent) error {
+		var in services.ClaimResponse
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		claim, err := services.RespondDamageClaim(e.App, e.Request.PathValue("id"), e.Auth.Id, in)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, claim)
+	}).Bind(apis.RequireAuth("users"))
+
+	// the support decides contested claims
+	se.Router.POST("/api/collections/v2/damage-claims/{id}/resolve", func(e *core.RequestEvent) error {
+		var in services.ClaimResolution
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		claim, err := services.ResolveDamageClaim(e.App, e.Request.PathValue("id"), in)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, claim)
+	}).Bind(apis.RequireSuperuserAuth())
+
+	// disputes without a claim, e.g. about a handed over item
+	se.Router.POST("/api/collections/v2/rents/{id}/resolve-dispute", func(e *core.RequestEvent) error {
+		var in services.DisputeResolution
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		rent, err := services.ResolveRentDispute(e.App, e.Request.PathValue("id"), in)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, rent)
+	}).Bind(apis.RequireSuperuserAuth())
+}
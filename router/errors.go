@@ -0,0 +1,465 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"uley_be/payments"
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const v2Prefix = "/api/collections/v2/"
+
+const (
+	codeValidationFailed     = "validation_failed"
+	codeInvalidBody          = "invalid_body"
+	codeInvalidParam         = "invalid_param"
+	codeInvalidImage         = "invalid_image"
+	codeInvalidPhotoOrder    = "invalid_photo_order"
+	codeInvalidCursor        = "invalid_cursor"
+	codeDistanceNeedsPoint   = "distance_needs_point"
+	codeInvalidDates         = "invalid_dates"
+	codeDatesInPast          = "dates_in_past"
+	codeInvalidRentLength    = "invalid_rent_length"
+	codeUnknownStatus        = "unknown_status"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeNotItemOwner         = "not_item_owner"
+	codeOwnItem              = "own_item"
+	codeNotRentParty         = "not_rent_party"
+	codeWrongParty           = "wrong_party"
+	codeNotFound             = "not_found"
+	codeItemNotFound         = "item_not_found"
+	codePhotoNotFound        = "photo_not_found"
+	codeRentNotFound         = "rent_not_found"
+	codeCategoryNotFound     = "category_not_found"
+	codeRentConflict         = "rent_conflict"
+	codeTransitionNotAllowed = "transition_not_allowed"
+	codeItemHasRents         = "item_has_rents"
+	codeInvalidSignature     = "invalid_signature"
+	codeRentNotPayable       = "rent_not_payable"
+	codeRentAlreadyPaid      = "rent_already_paid"
+	codePaymentNotFound      = "payment_not_found"
+	codePaymentsDisabled     = "payments_disabled"
+	codePayoutBatchNotFound  = "payout_batch_not_found"
+	codePayoutBatchPaid      = "payout_batch_paid"
+	codePayoutNotExported    = "payout_batch_not_exported"
+	codeClaimWindowClosed    = "claim_window_closed"
+	codeDepositNotHeld       = "deposit_not_held"
+	codeClaimExists          = "damage_claim_exists"
+	codeClaimNotFound        = "damage_claim_not_found"
+	codeClaimNotOpen         = "damage_claim_not_open"
+	codeClaimPending         = "damage_claim_pending"
+	codeCheckinNotFound      = "checkin_not_found"
+	codeInvalidCheckinCode   = "invalid_checkin_code"
+	codeCheckinCodeExpired   = "checkin_code_expired"
+	codeCheckinConfirmed     = "checkin_already_confirmed"
+	codeInternal             = "internal_error"
+)
+
+// errorMessages holds the user facing text of every code per language.
+var errorMessages = map[string]map[string]string{
+	codeValidationFailed: {
+		"ru": "Проверьте заполнение полей",
+		"kk": "Өрістердің толтырылуын тексеріңіз",
+		"en": "Some fields are invalid",
+	},
+	codeInvalidBody: {
+		"ru": "Некорректное тело запроса",
+		"kk": "Сұраудың денесі дұрыс емес",
+		"en": "Malformed request body",
+	},
+	codeInvalidParam: {
+		"ru": "Некорректный параметр запроса",
+		"kk": "Сұрау параметрі дұрыс емес",
+		"en": "Invalid query parameter",
+	},
+	codeInvalidImage: {
+		"ru": "Допускаются только изображения JPEG, PNG и WebP",
+		"kk": "Тек JPEG, PNG және WebP суреттеріне рұқсат етіледі",
+		"en": "Only JPEG, PNG and WebP images are allowed",
+	},
+	codeInvalidPhotoOrder: {
+		"ru": "Порядок должен содержать каждое фото объявления ровно один раз",
+		"kk": "Рет хабарландырудың әр фотосын бір реттен қамтуы керек",
+		"en": "Order must list every photo of the item exactly once",
+	},
+	codeInvalidCursor: {
+		"ru": "Некорректный курсор",
+		"kk": "Курсор дұрыс емес",
+		"en": "Invalid cursor",
+	},
+	codeDistanceNeedsPoint: {
+		"ru": "Для сортировки по расстоянию нужны lat и lng",
+		"kk": "Қашықтық бойынша сұрыптау үшін lat пен lng қажет",
+		"en": "Sorting by distance requires lat and lng",
+	},
+	codeInvalidDates: {
+		"ru": "Некорректные даты аренды",
+		"kk": "Жалға алу күндері дұрыс емес",
+		"en": "Invalid rent dates",
+	},
+	codeDatesInPast: {
+		"ru": "Даты аренды не могут быть в прошлом",
+		"kk": "Жалға алу күндері өткен уақытта болмауы керек",
+		"en": "Rent dates cannot be in the past",
+	},
+	codeInvalidRentLength: {
+		"ru": "Срок аренды вне допустимых для этой вещи пределов",
+		"kk": "Жалға алу мерзімі бұл зат үшін рұқсат етілген шектен тыс",
+		"en": "The rent length is outside of the limits of this item",
+	},
+	codeUnknownStatus: {
+		"ru": "Неизвестный статус",
+		"kk": "Белгісіз мәртебе",
+		"en": "Unknown status",
+	},
+	codeUnauthorized: {
+		"ru": "Требуется авторизация",
+		"kk": "Авторизация қажет",
+		"en": "Authentication required",
+	},
+	codeForbidden: {
+		"ru": "Недостаточно прав",
+		"kk": "Құқық жеткіліксіз",
+		"en": "Not allowed",
+	},
+	codeNotItemOwner: {
+		"ru": "Вы не владелец этого объявления",
+		"kk": "Сіз бұл хабарландырудың иесі емессіз",
+		"en": "You are not the owner of this item",
+	},
+	codeOwnItem: {
+		"ru": "Нельзя арендовать собственное объявление",
+		"kk": "Өз хабарландыруыңызды жалға алуға болмайды",
+		"en": "You cannot rent your own item",
+	},
+	codeNotRentParty: {
+		"ru": "Вы не участник этой аренды",
+		"kk": "Сіз бұл жалға алудың қатысушысы емессіз",
+		"en": "You are not a party of this rent",
+	},
+	codeWrongParty: {
+		"ru": "Этот переход должна выполнить другая сторона",
+		"kk": "Бұл ауысуды екінші тарап орындауы керек",
+		"en": "This transition must be made by the other party",
+	},
+	codeNotFound: {
+		"ru": "Не найдено",
+		"kk": "Табылмады",
+		"en": "Not found",
+	},
+	codeItemNotFound: {
+		"ru": "Объявление не найдено",
+		"kk": "Хабарландыру табылмады",
+		"en": "Item not found",
+	},
+	codePhotoNotFound: {
+		"ru": "Фото не найдено",
+		"kk": "Фото табылмады",
+		"en": "Photo not found",
+	},
+	codeRentNotFound: {
+		"ru": "Аренда не найдена",
+		"kk": "Жалға алу табылмады",
+		"en": "Rent not found",
+	},
+	codeCategoryNotFound: {
+		"ru": "Категория не найдена",
+		"kk": "Санат табылмады",
+		"en": "Category not found",
+	},
+	codeRentConflict: {
+		"ru": "Вещь уже забронирована на эти даты",
+		"kk": "Зат бұл күндерге брондалған",
+		"en": "The item is already booked for these dates",
+	},
+	codeTransitionNotAllowed: {
+		"ru": "Такой переход статуса невозможен",
+		"kk": "Мұндай мәртебе ауысуы мүмкін емес",
+		"en": "Status transition is not allowed",
+	},
+	codeItemHasRents: {
+		"ru": "У объявления есть аренды, его нельзя удалить",
+		"kk": "Хабарландыруда жалға алулар бар, оны жою мүмкін емес",
+		"en": "The item has rents and cannot be deleted",
+	},
+	codeInvalidSignature: {
+		"ru": "Неверная подпись уведомления",
+		"kk": "Хабарлама қолтаңбасы дұрыс емес",
+		"en": "Invalid webhook signature",
+	},
+	codeRentNotPayable: {
+		"ru": "Аренду можно оплатить только после одобрения",
+		"kk": "Жалға алуды тек мақұлданғаннан кейін төлеуге болады",
+		"en": "The rent can only be paid once it is approved",
+	},
+	codeRentAlreadyPaid: {
+		"ru": "Аренда уже оплачена",
+		"kk": "Жалға алу төленген",
+		"en": "The rent is already paid",
+	},
+	codePaymentNotFound: {
+		"ru": "Платёж не найден",
+		"kk": "Төлем табылмады",
+		"en": "Payment not found",
+	},
+	codePayoutBatchNotFound: {
+		"ru": "Пакет выплат не найден",
+		"kk": "Төлемдер пакеті табылмады",
+		"en": "Payout batch not found",
+	},
+	codePayoutBatchPaid: {
+		"ru": "Пакет выплат уже оплачен",
+		"kk": "Төлемдер пакеті төленген",
+		"en": "The payout batch is already paid",
+	},
+	codePayoutNotExported: {
+		"ru": "Сначала выгрузите пакет выплат для банка",
+		"kk": "Алдымен төлемдер пакетін банк үшін жүктеп алыңыз",
+		"en": "Export the payout batch for the bank first",
+	},
+	codeClaimWindowClosed: {
+		"ru": "Претензию можно подать только в течение срока после возврата",
+		"kk": "Шағымды тек қайтарғаннан кейінгі мерзім ішінде беруге болады",
+		"en": "Damage can only be claimed in the window after the return",
+	},
+	codeDepositNotHeld: {
+		"ru": "По аренде нет удержанного залога",
+		"kk": "Жалға алу бойынша ұсталған кепіл жоқ",
+		"en": "The rent has no held deposit",
+	},
+	codeClaimExists: {
+		"ru": "По аренде уже есть претензия",
+		"kk": "Жалға алу бойынша шағым бар",
+		"en": "The rent already has a damage claim",
+	},
+	codeClaimNotFound: {
+		"ru": "Претензия не найдена",
+		"kk": "Шағым табылмады",
+		"en": "Damage claim not found",
+	},
+	codeClaimNotOpen: {
+		"ru": "Претензию нельзя изменить в текущем статусе",
+		"kk": "Шағымды қазіргі мәртебеде өзгертуге болмайды",
+		"en": "The damage claim can't be changed in its current status",
+	},
+	codeClaimPending: {
+		"ru": "По аренде есть открытая претензия",
+		"kk": "Жалға алу бойынша ашық шағым бар",
+		"en": "The rent has an open damage claim",
+	},
+	codeCheckinNotFound: {
+		"ru": "Акт осмотра не найден",
+		"kk": "Тексеру актісі табылмады",
+		"en": "Check-in not found",
+	},
+	codeInvalidCheckinCode: {
+		"ru": "Неверный QR-код",
+		"kk": "QR-код жарамсыз",
+		"en": "Invalid QR code",
+	},
+	codeCheckinCodeExpired: {
+		"ru": "QR-код устарел, попросите владельца обновить его",
+		"kk": "QR-кодтың мерзімі өтті, иесінен оны жаңартуын сұраңыз",
+		"en": "The QR code has expired, ask the owner to refresh it",
+	},
+	codeCheckinConfirmed: {
+		"ru": "Акт осмотра уже подтверждён",
+		"kk": "Тексеру актісі расталған",
+		"en": "The check-in is already confirmed",
+	},
+	codePaymentsDisabled: {
+		"ru": "Оплата временно недоступна",
+		"kk": "Төлем уақытша қолжетімсіз",
+		"en": "Payments are not available",
+	},
+	codeInternal: {
+		"ru": "Внутренняя ошибка сервера",
+		"kk": "Сервердің ішкі қатесі",
+		"en": "Internal server error",
+	},
+}
+
+// ErrorBody is the "error" object of every v2 error response.
+type ErrorBody struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// bodyError wraps a request body that could not be decoded.
+type bodyError struct {
+	err error
+}
+
+func (e *bodyError) Error() string { return e.err.Error() }
+func (e *bodyError) Unwrap() error { return e.err }
+
+// classifyError maps an error to its HTTP status, code and details.
+func classifyError(err error) (int, string, map[string]any) {
+	var (
+		verr     services.ValidationError
+		conflict *services.RentConflictError
+		lerr     *services.RentLengthError
+		perr     services.ParamErrors
+		sorterr  *services.SortError
+		berr     *bodyError
+		apiErr   *router.ApiError
+	)
+
+	switch {
+	case errors.As(err, &verr):
+		return http.StatusBadRequest, codeValidationFailed, map[string]any{"fields": verr}
+	case errors.As(err, &perr):
+		return http.StatusBadRequest, codeInvalidParam, map[string]any{"params": perr}
+	case errors.As(err, &sorterr):
+		return http.StatusBadRequest, codeInvalidParam, map[string]any{
+			"params":  map[string]string{"sort": sorterr.Value},
+			"allowed": services.ItemSortKeys,
+		}
+	case errors.As(err, &berr):
+		return http.StatusBadRequest, codeInvalidBody, nil
+	case errors.As(err, &conflict):
+		return http.StatusConflict, codeRentConflict, map[string]any{
+			"conflict": map[string]any{
+				"id":         conflict.RentID,
+				"date_start": conflict.DateStart,
+				"date_end":   conflict.DateEnd,
+			},
+		}
+	case errors.As(err, &lerr):
+		return http.StatusBadRequest, codeInvalidRentLength, map[string]any{
+			"hours":     lerr.Hours,
+			"min_hours": lerr.MinHours,
+			"max_hours": lerr.MaxHours,
+		}
+	case errors.Is(err, services.ErrInvalidImage):
+		return http.StatusBadRequest, codeInvalidImage, nil
+	case errors.Is(err, services.ErrInvalidOrder):
+		return http.StatusBadRequest, codeInvalidPhotoOrder, nil
+	case errors.Is(err, services.ErrInvalidCursor):
+		return http.StatusBadRequest, codeInvalidCursor, nil
+	case errors.Is(err, services.ErrDistanceNeedsPoint):
+		return http.StatusBadRequest, codeDistanceNeedsPoint, nil
+	case errors.Is(err, services.ErrInvalidDates):
+		return http.StatusBadRequest, codeInvalidDates, map[string]any{"reason": err.Error()}
+	case errors.Is(err, services.ErrDatesInPast):
+		return http.StatusBadRequest, codeDatesInPast, nil
+	case errors.Is(err, services.ErrUnknownStatus):
+		return http.StatusBadRequest, codeUnknownStatus, nil
+	case errors.Is(err, services.ErrNotItemOwner):
+		return http.StatusForbidden, codeNotItemOwner, nil
+	case errors.Is(err, services.ErrOwnItem):
+		return http.StatusForbidden, codeOwnItem, nil
+	case errors.Is(err, services.ErrNotRentParty):
+		return http.StatusForbidden, codeNotRentParty, nil
+	case errors.Is(err, services.ErrWrongParty):
+		return http.StatusForbidden, codeWrongParty, nil
+	case errors.Is(err, services.ErrItemNotFound):
+		return http.StatusNotFound, codeItemNotFound, nil
+	case errors.Is(err, services.ErrPhotoNotFound):
+		return http.StatusNotFound, codePhotoNotFound, nil
+	case errors.Is(err, services.ErrRentNotFound):
+		return http.StatusNotFound, codeRentNotFound, nil
+	case errors.Is(err, services.ErrCategoryNotFound):
+		return http.StatusNotFound, codeCategoryNotFound, nil
+	case errors.Is(err, services.ErrTransitionNotAllowed):
+		return http.StatusConflict, codeTransitionNotAllowed, nil
+	case errors.Is(err, services.ErrItemHasRents):
+		return http.StatusConflict, codeItemHasRents, nil
+	case errors.Is(err, payments.ErrInvalidSignature), errors.Is(err, payments.ErrInvalidEvent):
+		return http.StatusBadRequest, codeInvalidSignature, nil
+	case errors.Is(err, services.ErrRentNotPayable):
+		return http.StatusConflict, codeRentNotPayable, nil
+	case errors.Is(err, services.ErrRentAlreadyPaid):
+		return http.StatusConflict, codeRentAlreadyPaid, nil
+	case errors.Is(err, services.ErrPaymentNotFound):
+		return http.StatusNotFound, codePaymentNotFound, nil
+	case errors.Is(err, services.ErrPayoutBatchNotFound):
+		return http.StatusNotFound, codePayoutBatchNotFound, nil
+	case errors.Is(err, services.ErrPayoutBatchPaid):
+		return http.StatusConflict, codePayoutBatchPaid, nil
+	case errors.Is(err, services.ErrPayoutBatchNotExported):
+		return http.StatusConflict, codePayoutNotExported, nil
+	case errors.Is(err, services.ErrClaimWindowClosed):
+		return http.StatusConflict, codeClaimWindowClosed, nil
+	case errors.Is(err, services.ErrDepositNotHeld):
+		return http.StatusConflict, codeDepositNotHeld, nil
+	case errors.Is(err, services.ErrDamageClaimExists):
+		return http.StatusConflict, codeClaimExists, nil
+	case errors.Is(err, services.ErrDamageClaimNotFound):
+		return http.StatusNotFound, codeClaimNotFound, nil
+	case errors.Is(err, services.ErrDamageClaimNotOpen):
+		return http.StatusConflict, codeClaimNotOpen, nil
+	case errors.Is(err, services.ErrDamageClaimPending):
+		return http.StatusConflict, codeClaimPending, nil
+	case errors.Is(err, services.ErrCheckinNotFound):
+		return http.StatusNotFound, codeCheckinNotFound, nil
+	case errors.Is(err, services.ErrInvalidCheckinCode):
+		return http.StatusBadRequest, codeInvalidCheckinCode, nil
+	case errors.Is(err, services.ErrCheckinCodeExpired):
+		return http.StatusBadRequest, codeCheckinCodeExpired, nil
+	case errors.Is(err, services.ErrCheckinConfirmed):
+		return http.StatusConflict, codeCheckinConfirmed, nil
+	case errors.Is(err, services.ErrNoPaymentProvider):
+		return http.StatusServiceUnavailable, codePaymentsDisabled, nil
+	case errors.Is(err, services.ErrUnknownProvider), errors.Is(err, services.ErrNotFakeProvider):
+		return http.StatusNotFound, codeNotFound, nil
+	case errors.As(err, &apiErr):
+		// errors of the PocketBase middlewares (RequireAuth etc.)
+		switch apiErr.Status {
+		case http.StatusUnauthorized:
+			return apiErr.Status, codeUnauthorized, nil
+		case http.StatusForbidden:
+			return apiErr.Status, codeForbidden, nil
+		case http.StatusNotFound:
+			return apiErr.Status, codeNotFound, nil
+		case http.StatusBadRequest:
+			return apiErr.Status, codeInvalidBody, nil
+		}
+	}
+	return http.StatusInternalServerError, codeInternal, nil
+}
+
+// apiError writes err as {"error": {code, message, details}}.
+func apiError(e *core.RequestEvent, err error) error {
+	status, code, details := classifyError(err)
+	if status == http.StatusInternalServerError {
+		e.App.Logger().Error("v2 request failed", "path", e.Request.URL.Path, "error", err.Error())
+	}
+
+	return e.JSON(status, map[string]any{"error": ErrorBody{
+		Code:    code,
+		Message: errorMessages[code][requestLang(e)],
+		Details: details,
+	}})
+}
+
+// recoverErrors turns panics and unhandled errors of the v2 routes into the
+// error envelope; the rest of the API keeps the PocketBase format.
+func recoverErrors(e *core.RequestEvent) (err error) {
+	if !strings.HasPrefix(e.Request.URL.Path, v2Prefix) {
+		return e.Next()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = apiError(e, fmt.Errorf("panic: %v\n%s", r, debug.Stack()))
+		}
+	}()
+
+	if err := e.Next(); err != nil {
+		if e.Written() {
+			return err
+		}
+		return apiError(e, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"math"
+
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func registerFavoriteRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/collections/v2/favorites", func(e *core.RequestEvent) error {
+		q := parseQuery(e.Request.URL.Query(), "limit", "offset", "page", "sort", "lang")
+
+		f := services.ItemsFilter{
+			Limit:       q.Int("limit", 0, 1, services.MaxItemsLimit),
+			Offset:      q.Int("offset", 0, 0, math.MaxInt32),
+			Page:        q.Int("page", 0, 1, math.MaxInt32),
+			Sort:        q.String("sort"),
+			Lang:        requestLang(e),
+			FavoritesOf: e.Auth.Id,
+			ViewerID:    e.Auth.Id,
+		}
+		if q.Has("page") && q.Has("offset") {
+			q.Fail("page", "use either page or offset")
+		}
+		if err := q.Err(); err != nil {
+			return apiError(e, err)
+		}
+
+		items, err := services.ListItems(e.App, f)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, items)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.PUT("/api/collections/v2/favorites/{itemId}", func(e *core.RequestEvent) error {
+		state, err := services.AddFavorite(e.App, e.Auth.Id, e.Request.PathValue("itemId"))
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, state)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.DELETE("/api/collections/v2/favorites/{itemId}", func(e *core.RequestEvent) error {
+		state, err := services.RemoveFavorite(e.App, e.Auth.Id, e.Request.PathValue("itemId"))
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, state)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.POST("/api/collections/v2/favorites/{itemId}/toggle", func(e *core.RequestEvent) error {
+		state, err := services.ToggleFavorite(e.App, e.Auth.Id, e.Request.PathValue("itemId"))
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, state)
+	}).Bind(apis.RequireAuth("users"))
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func registerOwnerItemRoutes(se *core.ServeEvent) {
+	se.Router.POST("/api/collections/v2/items", func(e *core.RequestEvent) error {
+		var in services.ItemInput
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		item, err := services.CreateItem(e.App, e.Auth.Id, in, requestLang(e))
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(201, item)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.PATCH("/api/collections/v2/items/{id}", func(e *core.RequestEvent) error {
+		var in services.ItemInput
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		item, err := services.UpdateItem(e.App, e.Request.PathValue("id"), e.Auth.Id, in, requestLang(e))
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, item)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.DELETE("/api/collections/v2/items/{id}", func(e *core.RequestEvent) error {
+		if err := services.DeleteItem(e.App, e.Request.PathValue("id"), e.Auth.Id); err != nil {
+			return apiError(e, err)
+		}
+
+		return e.NoContent(204)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.POST("/api/collections/v2/items/{id}/photos", func(e *core.RequestEvent) error {
+		files, err := e.FindUploadedFiles("file")
+		if err != nil {
+			return apiError(e, services.ValidationError{"file": "cannot be blank"})
+		}
+
+		photo, err := services.AddItemPhoto(e.App, e.Request.PathValue("id"), e.Auth.Id, files[0])
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(201, photo)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.PUT("/api/collections/v2/items/{id}/photos/order", func(e *core.RequestEvent) error {
+		var in struct {
+			Photos []string `json:"photos"`
+		}
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		photos, err := services.ReorderItemPhotos(e.App, e.Request.PathValue("id"), e.Auth.Id, in.Photos)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"photos": photos})
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.DELETE("/api/collections/v2/items/{id}/photos/{photoId}", func(e *core.RequestEvent) error {
+		err := services.DeleteItemPhoto(e.App, e.Request.PathValue("id"), e.Request.PathValue("photoId"), e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.NoContent(204)
+	}).Bind(apis.RequireAuth("users"))
+}
@@ -0,0 +1,20 @@
+package router
+
+import (
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func registerLedgerRoutes(se *core.ServeEvent) {
+	// the owner's payable balance
+	se.Router.GET("/api/collections/v2/ledger/balance", func(e *core.RequestEvent) error {
+		balance, err := services.GetOwnerBalance(e.App, e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, balance)
+	}).Bind(apis.RequireAuth("users"))
+}
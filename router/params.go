@@ -0,0 +1,178 @@
+package router
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// queryParams reads typed query values and collects every problem, so the
+// client gets all of them in one response.
+type queryParams struct {
+	values url.Values
+	errs   services.ParamErrors
+}
+
+// parseQuery rejects parameters outside of allowed and repeated ones, an
+// allowed entry ending with "*" accepts any parameter with that prefix.
+func parseQuery(values url.Values, allowed ...string) *queryParams {
+	p := &queryParams{values: values, errs: services.ParamErrors{}}
+	for key, v := range values {
+		switch {
+		case !paramAllowed(allowed, key):
+			p.errs[key] = "unknown parameter"
+		case len(v) > 1:
+			p.errs[key] = "must be given once"
+		}
+	}
+	return p
+}
+
+func paramAllowed(allowed []string, key string) bool {
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, "*"); ok && strings.HasPrefix(key, prefix) {
+			return true
+		}
+		if a == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys returns the names of the given parameters starting with prefix, sorted.
+func (p *queryParams) Keys(prefix string) []string {
+	keys := []string{}
+	for key := range p.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (p *queryParams) Has(key string) bool {
+	return p.values.Has(key)
+}
+
+func (p *queryParams) String(key string) string {
+	return strings.TrimSpace(p.values.Get(key))
+}
+
+// Int returns the value within [min, max], def when the param is missing.
+func (p *queryParams) Int(key string, def, min, max int) int {
+	raw := p.String(key)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		p.errs[key] = "must be an integer"
+		return def
+	}
+	if v < min || v > max {
+		p.errs[key] = fmt.Sprintf("must be between %d and %d", min, max)
+		return def
+	}
+	return v
+}
+
+// Float returns nil when the param is missing.
+func (p *queryParams) Float(key string, min, max float64) *float64 {
+	raw := p.String(key)
+	if raw == "" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		p.errs[key] = "must be a number"
+		return nil
+	}
+	if v < min || v > max {
+		p.errs[key] = fmt.Sprintf("must be between %g and %g", min, max)
+		return nil
+	}
+	return &v
+}
+
+func (p *queryParams) Bool(key string) bool {
+	raw := p.String(key)
+	if raw == "" {
+		return false
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		p.errs[key] = "must be true or false"
+	}
+	return v
+}
+
+// OptBool returns nil when the param is missing.
+func (p *queryParams) OptBool(key string) *bool {
+	if p.String(key) == "" {
+		return nil
+	}
+	v := p.Bool(key)
+	return &v
+}
+
+// List splits a comma separated value, empty entries are dropped.
+func (p *queryParams) List(key string) []string {
+	list := []string{}
+	for _, v := range strings.Split(p.values.Get(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// OneOf returns the value if it is one of options, def when missing.
+func (p *queryParams) OneOf(key, def string, options ...string) string {
+	raw := p.String(key)
+	if raw == "" {
+		return def
+	}
+	if !slices.Contains(options, raw) {
+		p.errs[key] = "must be one of " + strings.Join(options, ", ")
+		return def
+	}
+	return raw
+}
+
+// DateTime accepts a date (2006-01-02) or a full datetime.
+func (p *queryParams) DateTime(key string) types.DateTime {
+	raw := p.String(key)
+	if raw == "" {
+		return types.DateTime{}
+	}
+	v, err := types.ParseDateTime(raw)
+	if err != nil || v.IsZero() {
+		p.errs[key] = "must be a date (YYYY-MM-DD) or a datetime"
+		return types.DateTime{}
+	}
+	return v
+}
+
+// Fail records a problem found outside of the typed getters.
+func (p *queryParams) Fail(key, reason string) {
+	if _, ok := p.errs[key]; !ok {
+		p.errs[key] = reason
+	}
+}
+
+// Err returns the collected problems, nil if there were none.
+func (p *queryParams) Err() error {
+	if len(p.errs) == 0 {
+		return nil
+	}
+	return p.errs
+}
@@ -0,0 +1,67 @@
+package router
+
+import (
+	"io"
+
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxWebhookSize caps the webhook payloads read into memory.
+const maxWebhookSize = 1 << 20
+
+func registerPaymentRoutes(se *core.ServeEvent) {
+	se.Router.POST("/api/collections/v2/rents/{id}/pay", func(e *core.RequestEvent) error {
+		created, err := services.PayRent(e.App, e.Request.PathValue("id"), e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"items": created})
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.GET("/api/collections/v2/rents/{id}/payments", func(e *core.RequestEvent) error {
+		list, err := services.RentPayments(e.App, e.Request.PathValue("id"), e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"items": list})
+	}).Bind(apis.RequireAuth("users"))
+
+	// called by the provider, authenticated by the signature only
+	se.Router.POST("/api/collections/v2/payments/webhooks/{provider}", func(e *core.RequestEvent) error {
+		payload, err := io.ReadAll(io.LimitReader(e.Request.Body, maxWebhookSize))
+		if err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		err = services.HandlePaymentWebhook(e.App, e.Request.PathValue("provider"), payload, e.Request.Header)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"received": true})
+	})
+
+	// the fake checkout exists only where the fake provider was chosen
+	if !services.FakePayments(se.App) {
+		return
+	}
+	se.Router.POST("/api/collections/v2/payments/fake/{providerId}/confirm", func(e *core.RequestEvent) error {
+		q := parseQuery(e.Request.URL.Query(), "outcome", "lang")
+		outcome := q.OneOf("outcome", "success", "success", "fail")
+		if err := q.Err(); err != nil {
+			return apiError(e, err)
+		}
+
+		err := services.ConfirmFakePayment(e.App, e.Request.PathValue("providerId"), e.Auth.Id, outcome == "fail")
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.NoContent(204)
+	}).Bind(apis.RequireAuth("users"))
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func registerPayoutRoutes(se *core.ServeEvent) {
+	// the owner's side
+	se.Router.GET("/api/collections/v2/payouts", func(e *core.RequestEvent) error {
+		list, err := services.OwnerPayouts(e.App, e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"items": list})
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.GET("/api/collections/v2/statements", func(e *core.RequestEvent) error {
+		q := parseQuery(e.Request.URL.Query(), "month", "format", "lang")
+		format := q.OneOf("format", "json", "json", "pdf")
+		month := q.String("month")
+		if month == "" {
+			month = time.Now().UTC().Format("2006-01")
+		}
+		if err := q.Err(); err != nil {
+			return apiError(e, err)
+		}
+		start, err := services.ParseStatementMonth(month)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		statement, err := services.GetOwnerStatement(e.App, e.Auth.Id, start)
+		if err != nil {
+			return apiError(e, err)
+		}
+		if format == "json" {
+			return e.JSON(200, statement)
+		}
+
+		name := strings.TrimSpace(e.Auth.GetString("first_name") + " " + e.Auth.GetString("last_name"))
+		e.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s.pdf"`, statement.Month))
+		return e.Blob(200, "application/pdf", services.StatementPDF(statement, name))
+	}).Bind(apis.RequireAuth("users"))
+
+	// the back office
+	se.Router.GET("/api/collections/v2/payout-batches", func(e *core.RequestEvent) error {
+		list, err := services.ListPayoutBatches(e.App)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"items": list})
+	}).Bind(apis.RequireSuperuserAuth())
+
+	se.Router.GET("/api/collections/v2/payout-batches/{id}/export.csv", func(e *core.RequestEvent) error {
+		id := e.Request.PathValue("id")
+		// the file is built before the batch is marked exported, so a
+		// failed export can be downloaded again
+		body := &bytes.Buffer{}
+		if err := services.ExportPayoutBatch(e.App, id, body); err != nil {
+			return apiError(e, err)
+		}
+
+		e.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="payouts-%s.csv"`, id))
+		return e.Blob(200, "text/csv; charset=utf-8", body.Bytes())
+	}).Bind(apis.RequireSuperuserAuth())
+
+	se.Router.POST("/api/collections/v2/payout-batches/{id}/paid", func(e *core.RequestEvent) error {
+		batch, err := services.MarkPayoutBatchPaid(e.App, e.Request.PathValue("id"))
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, batch)
+	}).Bind(apis.RequireSuperuserAuth())
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func registerRentRoutes(se *core.ServeEvent) {
+	se.Router.POST("/api/collections/v2/rents", func(e *core.RequestEvent) error {
+		var in services.RentInput
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		rent, err := services.CreateRent(e.App, e.Auth.Id, in)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(201, rent)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.POST("/api/collections/v2/rents/{id}/transition", func(e *core.RequestEvent) error {
+		var in services.TransitionInput
+		if err := e.BindBody(&in); err != nil {
+			return apiError(e, &bodyError{err})
+		}
+
+		rent, err := services.TransitionRent(e.App, e.Request.PathValue("id"), e.Auth.Id, in)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, rent)
+	}).Bind(apis.RequireAuth("users"))
+
+	// what cancelling the rent now would refund
+	se.Router.GET("/api/collections/v2/rents/{id}/cancellation", func(e *core.RequestEvent) error {
+		breakdown, err := services.PreviewCancellation(e.App, e.Request.PathValue("id"), e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, breakdown)
+	}).Bind(apis.RequireAuth("users"))
+
+	se.Router.GET("/api/collections/v2/rents/{id}/history", func(e *core.RequestEvent) error {
+		history, err := services.RentStatusHistory(e.App, e.Request.PathValue("id"), e.Auth.Id)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"items": history})
+	}).Bind(apis.RequireAuth("users"))
+}
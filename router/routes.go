@@ -1,8 +1,10 @@
 package router
 
 import (
+	"errors"
+	"math"
 	"os"
-	"strconv"
+	"regexp"
 	"strings"
 
 	"uley_be/services"
@@ -11,33 +13,89 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// itemsListParams are the query parameters accepted by the items listing.
+var itemsListParams = []string{
+	"limit", "offset", "page", "cursor", "sort", "facets",
+	"search", "location", "location_id", "min_price", "max_price",
+	"category_id", "tags", "tags_match", "has_photos", "author", "match",
+	"lat", "lng", "radius_km", "available_from", "available_to", "lang",
+	"attr.*",
+}
+
+// attributeKeyRe matches the keys of category attributes.
+var attributeKeyRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// maxRadiusKm is about the size of Kazakhstan.
+const maxRadiusKm = 3000
+
 func RegisterRoutes(app core.App) {
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
-		se.Router.GET("/api/collections/v2/items", func(e *core.RequestEvent) error {
-			q := e.Request.URL.Query()
+		se.Router.BindFunc(recoverErrors)
 
-			limit, _ := strconv.Atoi(q.Get("limit"))
-			offset, _ := strconv.Atoi(q.Get("offset"))
-			sort := q.Get("sort")
+		se.Router.GET("/api/collections/v2/items", func(e *core.RequestEvent) error {
+			q := parseQuery(e.Request.URL.Query(), itemsListParams...)
 
-			var maxP *float64
-			if v := strings.TrimSpace(q.Get("max_price")); v != "" {
-				if f, err := strconv.ParseFloat(v, 64); err == nil {
-					maxP = &f
+			f := services.ItemsFilter{
+				Limit:         q.Int("limit", 0, 1, services.MaxItemsLimit),
+				Offset:        q.Int("offset", 0, 0, math.MaxInt32),
+				Page:          q.Int("page", 0, 1, math.MaxInt32),
+				Sort:          q.String("sort"),
+				Location:      q.String("location"),
+				LocationID:    q.String("location_id"),
+				Search:        q.String("search"),
+				CursorMode:    q.Has("cursor"),
+				Cursor:        q.String("cursor"),
+				Facets:        q.Bool("facets"),
+				Lat:           q.Float("lat", -90, 90),
+				Lng:           q.Float("lng", -180, 180),
+				AvailableFrom: q.DateTime("available_from"),
+				AvailableTo:   q.DateTime("available_to"),
+				MinPrice:      q.Float("min_price", 0, math.MaxFloat64),
+				MaxPrice:      q.Float("max_price", 0, math.MaxFloat64),
+				CategoryIDs:   q.List("category_id"),
+				Tags:          q.List("tags"),
+				TagsMatch:     q.OneOf("tags_match", services.MatchAny, services.MatchAny, services.MatchAll),
+				HasPhotos:     q.OptBool("has_photos"),
+				AuthorIDs:     q.List("author"),
+				Match:         q.OneOf("match", services.MatchAll, services.MatchAll, services.MatchAny),
+				Lang:          requestLang(e),
+				ViewerID:      viewerID(e),
+			}
+			if f.Sort != "" {
+				var sorterr *services.SortError
+				if err := services.ValidateItemSort(f.Sort, f.Search); errors.As(err, &sorterr) {
+					q.Fail("sort", sorterr.Value)
+				}
+			}
+			if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+				q.Fail("min_price", "must not exceed max_price")
+			}
+			if !f.AvailableFrom.IsZero() && !f.AvailableTo.IsZero() && f.AvailableTo.Before(f.AvailableFrom) {
+				q.Fail("available_to", "must be after available_from")
+			}
+			f.Attributes = attributeFilters(q)
+			if r := q.Float("radius_km", 0.1, maxRadiusKm); r != nil {
+				f.RadiusKm = *r
+				if f.Lat == nil || f.Lng == nil {
+					q.Fail("radius_km", "requires lat and lng")
 				}
 			}
+			if q.Has("lat") != q.Has("lng") {
+				q.Fail("lat", "lat and lng must be given together")
+			}
+			if q.Has("page") && q.Has("offset") {
+				q.Fail("page", "use either page or offset")
+			}
+			if f.CursorMode && (q.Has("page") || q.Has("offset")) {
+				q.Fail("cursor", "cannot be combined with page or offset")
+			}
+			if err := q.Err(); err != nil {
+				return apiError(e, err)
+			}
 
-			items, err := services.ListItems(e.App, services.ItemsFilter{
-				MaxPrice:   maxP,
-				Location:   q.Get("location"),
-				Search:     q.Get("search"),
-				CategoryID: q.Get("category_id"),
-				Limit:      limit,
-				Offset:     offset,
-				Sort:       sort,
-			})
+			items, err := services.ListItems(e.App, f)
 			if err != nil {
-				return e.JSON(500, map[string]any{"error": err.Error()})
+				return apiError(e, err)
 			}
 
 			return e.JSON(200, items)
@@ -45,19 +103,123 @@ func RegisterRoutes(app core.App) {
 
 		se.Router.GET("/api/collections/v2/items/{id}", func(e *core.RequestEvent) error {
 			id := e.Request.PathValue("id")
-			item, err := services.GetItem(e.App, id)
+			item, err := services.GetItem(e.App, id, viewerID(e), requestLang(e))
 			if err != nil {
-				return e.JSON(500, map[string]any{"error": err.Error()})
-			}
-			if item == nil {
-				return e.JSON(404, map[string]any{"error": "item not found"})
+				return apiError(e, err)
 			}
 			return e.JSON(200, item)
 		})
 
+		se.Router.GET("/api/collections/v2/items/{id}/availability", func(e *core.RequestEvent) error {
+			q := parseQuery(e.Request.URL.Query(), "from", "to", "lang")
+			from := q.DateTime("from")
+			to := q.DateTime("to")
+			if err := q.Err(); err != nil {
+				return apiError(e, err)
+			}
+
+			availability, err := services.ItemAvailability(e.App, e.Request.PathValue("id"), from, to)
+			if err != nil {
+				return apiError(e, err)
+			}
+			return e.JSON(200, availability)
+		})
+
+		se.Router.GET("/api/collections/v2/items/{id}/quote", func(e *core.RequestEvent) error {
+			q := parseQuery(e.Request.URL.Query(), "from", "to", "lang")
+			from := q.DateTime("from")
+			to := q.DateTime("to")
+			for _, key := range []string{"from", "to"} {
+				if !q.Has(key) {
+					q.Fail(key, "is required")
+				}
+			}
+			if err := q.Err(); err != nil {
+				return apiError(e, err)
+			}
+
+			quote, err := services.QuoteItem(e.App, e.Request.PathValue("id"), from, to)
+			if err != nil {
+				return apiError(e, err)
+			}
+			return e.JSON(200, quote)
+		})
+
+		se.Router.GET("/api/collections/v2/locations", func(e *core.RequestEvent) error {
+			q := parseQuery(e.Request.URL.Query(), "q", "limit", "lang")
+			limit := q.Int("limit", 0, 1, 50)
+			if err := q.Err(); err != nil {
+				return apiError(e, err)
+			}
+
+			return e.JSON(200, map[string]any{"items": services.SuggestLocations(q.String("q"), limit)})
+		})
+
+		registerOwnerItemRoutes(se)
+		registerRentRoutes(se)
+		registerTagRoutes(se)
+		registerCategoryRoutes(se)
+		registerFavoriteRoutes(se)
+		registerPaymentRoutes(se)
+		registerLedgerRoutes(se)
+		registerPayoutRoutes(se)
+		registerDamageClaimRoutes(se)
+		registerCheckinRoutes(se)
+
 		// статика
 		se.Router.GET("/{path...}", apis.Static(os.DirFS("./pb_public"), false))
 
 		return se.Next()
 	})
 }
+
+// viewerID returns the id of the authenticated app user, "" for guests.
+func viewerID(e *core.RequestEvent) string {
+	if e.Auth == nil || e.Auth.Collection().Name != "users" {
+		return ""
+	}
+	return e.Auth.Id
+}
+
+// attributeFilters reads attr.<key>=a,b, attr.<key>.min= and attr.<key>.max=.
+func attributeFilters(q *queryParams) []services.AttributeFilter {
+	filters := []services.AttributeFilter{}
+	index := map[string]int{}
+
+	for _, param := range q.Keys("attr.") {
+		key := strings.TrimPrefix(param, "attr.")
+		bound := ""
+		if k, ok := strings.CutSuffix(key, ".min"); ok {
+			key, bound = k, "min"
+		} else if k, ok := strings.CutSuffix(key, ".max"); ok {
+			key, bound = k, "max"
+		}
+		if !attributeKeyRe.MatchString(key) {
+			q.Fail(param, "invalid attribute key")
+			continue
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(filters)
+			index[key] = i
+			filters = append(filters, services.AttributeFilter{Key: key})
+		}
+
+		switch bound {
+		case "min":
+			filters[i].Min = q.Float(param, -math.MaxFloat64, math.MaxFloat64)
+		case "max":
+			filters[i].Max = q.Float(param, -math.MaxFloat64, math.MaxFloat64)
+		default:
+			filters[i].Values = q.List(param)
+		}
+	}
+
+	return filters
+}
+
+// requestLang is the content language of the request, see services.ResolveLang.
+func requestLang(e *core.RequestEvent) string {
+	return services.ResolveLang(e.Request.URL.Query().Get("lang"), e.Request.Header.Get("Accept-Language"))
+}
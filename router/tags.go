@@ -0,0 +1,39 @@
+package router
+
+import (
+	"uley_be/services"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func registerTagRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/collections/v2/tags", func(e *core.RequestEvent) error {
+		q := parseQuery(e.Request.URL.Query(), "q", "limit", "lang")
+		limit := q.Int("limit", 0, 1, 50)
+		if err := q.Err(); err != nil {
+			return apiError(e, err)
+		}
+
+		tags, err := services.SuggestTags(e.App, q.String("q"), limit)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"items": tags})
+	})
+
+	se.Router.GET("/api/collections/v2/tags/popular", func(e *core.RequestEvent) error {
+		q := parseQuery(e.Request.URL.Query(), "category_id", "limit", "lang")
+		limit := q.Int("limit", 0, 1, 50)
+		if err := q.Err(); err != nil {
+			return apiError(e, err)
+		}
+
+		tags, err := services.PopularTags(e.App, q.String("category_id"), limit)
+		if err != nil {
+			return apiError(e, err)
+		}
+
+		return e.JSON(200, map[string]any{"items": tags})
+	})
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// contactRentStatuses are the rent statuses after the owner approved the
+// request; only then do both sides get each other's contacts.
+var contactRentStatuses = []string{StatusApproved, StatusHandedOver, StatusReturned, StatusDisputed}
+
+// PublicAuthor is the author shape returned with items. Cancellations are
+// the rents the user called off as an owner. Phone and Identity are only
+// set for the counterparty of an approved rent.
+type PublicAuthor struct {
+	Id            string   `json:"id"`
+	Name          string   `json:"name"`
+	Avatar        string   `json:"avatar"`
+	Rating        *float64 `json:"rating"`
+	Reviews       int      `json:"reviews_count"`
+	MemberSince   string   `json:"member_since"`
+	Cancellations int      `json:"owner_cancellations_count"`
+	Phone         string   `json:"phone,omitempty"`
+	Identity      string   `json:"identity,omitempty"`
+}
+
+func publicAuthor(user *core.Record, withContacts bool) PublicAuthor {
+	author := PublicAuthor{
+		Id:            user.Id,
+		Name:          strings.TrimSpace(user.GetString("first_name") + " " + user.GetString("last_name")),
+		Avatar:        user.GetString("avatar"),
+		Reviews:       user.GetInt("reviews_count"),
+		MemberSince:   user.GetDateTime("created").Time().Format("2006-01"),
+		Cancellations: user.GetInt("owner_cancellations_count"),
+	}
+	if author.Reviews > 0 {
+		rating := user.GetFloat("rating")
+		author.Rating = &rating
+	}
+	if withContacts {
+		author.Phone = user.GetString("phone")
+		author.Identity = user.GetString("identity")
+	}
+	return author
+}
+
+// rentCounterparties returns which of authorIDs share an approved rent with
+// viewerID, in either direction.
+func rentCounterparties(app core.App, viewerID string, authorIDs []string) (map[string]bool, error) {
+	result := map[string]bool{}
+	if viewerID == "" || len(authorIDs) == 0 {
+		return result, nil
+	}
+
+	ids := make([]any, len(authorIDs))
+	for i, id := range authorIDs {
+		ids[i] = id
+	}
+	statuses := make([]any, len(contactRentStatuses))
+	for i, s := range contactRentStatuses {
+		statuses[i] = s
+	}
+
+	rows := []struct {
+		Owner  string `db:"owner"`
+		Renter string `db:"renter"`
+	}{}
+	err := app.DB().
+		Select("items.author AS owner", "rents.renter AS renter").
+		From("rents").
+		InnerJoin("items", dbx.NewExp("items.id = rents.item")).
+		InnerJoin("statuses", dbx.NewExp("statuses.id = rents.status")).
+		Where(dbx.In("statuses.name", statuses...)).
+		AndWhere(dbx.Or(
+			dbx.And(dbx.HashExp{"rents.renter": viewerID}, dbx.In("items.author", ids...)),
+			dbx.And(dbx.HashExp{"items.author": viewerID}, dbx.In("rents.renter", ids...)),
+		)).
+		Distinct(true).
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if row.Owner == viewerID {
+			result[row.Renter] = true
+		} else {
+			result[row.Owner] = true
+		}
+	}
+	return result, nil
+}
+
+// setPublicAuthors replaces the expanded author of every exported item with
+// its public profile. The viewer always sees their own contacts.
+func setPublicAuthors(app core.App, viewerID string, records []*core.Record, exported []map[string]any) error {
+	authorIDs := make([]string, 0, len(records))
+	for _, r := range records {
+		authorIDs = append(authorIDs, r.GetString("author"))
+	}
+
+	users, err := app.FindRecordsByIds("users", authorIDs)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*core.Record, len(users))
+	for _, u := range users {
+		byID[u.Id] = u
+	}
+
+	counterparties, err := rentCounterparties(app, viewerID, authorIDs)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range records {
+		expand, _ := exported[i]["expand"].(map[string]any)
+		if expand == nil {
+			expand = map[string]any{}
+			exported[i]["expand"] = expand
+		}
+		delete(expand, "author")
+
+		user := byID[r.GetString("author")]
+		if user == nil {
+			continue
+		}
+		expand["author"] = publicAuthor(user, user.Id == viewerID || counterparties[user.Id])
+	}
+	return nil
+}
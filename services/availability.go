@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	dayLayout = "2006-01-02"
+
+	defaultAvailabilityDays = 90
+	maxAvailabilityDays     = 366
+)
+
+// DayRange is an inclusive range of calendar days.
+type DayRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type AvailabilityResponse struct {
+	Item    string     `json:"item"`
+	From    string     `json:"from"`
+	To      string     `json:"to"`
+	Booked  []DayRange `json:"booked"`
+	Blocked []DayRange `json:"blocked"`
+	Free    []DayRange `json:"free"`
+}
+
+const (
+	dayFree = iota
+	dayBlocked
+	dayBooked
+)
+
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// bookingWindow fills in a missing side of a requested [from, to) window.
+func bookingWindow(from, to types.DateTime) (types.DateTime, types.DateTime) {
+	if from.IsZero() {
+		from, _ = types.ParseDateTime(startOfDay(time.Now()))
+	}
+	if to.IsZero() || !to.After(from) {
+		to = from.AddDate(0, 0, 1)
+	}
+	return from, to
+}
+
+// notBookedExpr matches items without active rents intersecting [start, end).
+func notBookedExpr(start, end types.DateTime) dbx.Expression {
+	params := dbx.Params{"available_from": start.String(), "available_to": end.String()}
+	placeholders := make([]string, len(inactiveRentStatuses))
+	for i, name := range inactiveRentStatuses {
+		key := fmt.Sprintf("available_inactive%d", i)
+		placeholders[i] = "{:" + key + "}"
+		params[key] = name
+	}
+
+	return dbx.NewExp(
+		"NOT EXISTS (SELECT 1 FROM [[rents]] r LEFT JOIN [[statuses]] s ON s.[[id]] = r.[[status]]"+
+			" WHERE r.[[item]] = [[items.id]]"+
+			" AND r.[[date_start]] < {:available_to} AND r.[[date_end]] > {:available_from}"+
+			" AND COALESCE(s.[[name]], '') NOT IN ("+strings.Join(placeholders, ", ")+"))",
+		params,
+	)
+}
+
+// ItemAvailability splits the days in [from, to] into booked, blocked and free ranges.
+// Confirmed rents are booked; pending requests and past days are blocked.
+func ItemAvailability(app core.App, itemID string, from, to types.DateTime) (AvailabilityResponse, error) {
+	if _, err := app.FindRecordById("items", itemID); err != nil {
+		return AvailabilityResponse{}, ErrItemNotFound
+	}
+
+	today := startOfDay(time.Now())
+	first := today
+	if !from.IsZero() {
+		first = startOfDay(from.Time())
+	}
+	last := first.AddDate(0, 0, defaultAvailabilityDays-1)
+	if !to.IsZero() {
+		last = startOfDay(to.Time())
+	}
+	if last.Before(first) {
+		return AvailabilityResponse{}, fmt.Errorf("%w: to must not be before from", ErrInvalidDates)
+	}
+	if last.Sub(first) >= maxAvailabilityDays*24*time.Hour {
+		return AvailabilityResponse{}, fmt.Errorf("%w: range is longer than %d days", ErrInvalidDates, maxAvailabilityDays)
+	}
+
+	days := int(last.Sub(first)/(24*time.Hour)) + 1
+	state := make([]int, days)
+
+	for i := range state {
+		if first.AddDate(0, 0, i).Before(today) {
+			state[i] = dayBlocked
+		}
+	}
+
+	windowStart, _ := types.ParseDateTime(first)
+	windowEnd, _ := types.ParseDateTime(last.AddDate(0, 0, 1))
+
+	rents, err := activeRentsOverlapping(app, itemID, windowStart, windowEnd, 0)
+	if err != nil {
+		return AvailabilityResponse{}, err
+	}
+	_ = app.ExpandRecords(rents, []string{"status"}, nil)
+
+	for _, rent := range rents {
+		mark := dayBooked
+		if status := rent.ExpandedOne("status"); status == nil || status.GetString("name") == StatusRequested {
+			mark = dayBlocked
+		}
+
+		start := rent.GetDateTime("date_start").Time()
+		end := rent.GetDateTime("date_end").Time()
+		for i := range state {
+			day := first.AddDate(0, 0, i)
+			if day.Before(end) && day.AddDate(0, 0, 1).After(start) && mark > state[i] {
+				state[i] = mark
+			}
+		}
+	}
+
+	resp := AvailabilityResponse{
+		Item:    itemID,
+		From:    first.Format(dayLayout),
+		To:      last.Format(dayLayout),
+		Booked:  []DayRange{},
+		Blocked: []DayRange{},
+		Free:    []DayRange{},
+	}
+
+	for i := 0; i < days; {
+		j := i
+		for j+1 < days && state[j+1] == state[i] {
+			j++
+		}
+		r := DayRange{
+			From: first.AddDate(0, 0, i).Format(dayLayout),
+			To:   first.AddDate(0, 0, j).Format(dayLayout),
+		}
+		switch state[i] {
+		case dayBooked:
+			resp.Booked = append(resp.Booked, r)
+		case dayBlocked:
+			resp.Blocked = append(resp.Blocked, r)
+		default:
+			resp.Free = append(resp.Free, r)
+		}
+		i = j + 1
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Cancellation policies of items.
+const (
+	PolicyFlexible = "flexible"
+	PolicyModerate = "moderate"
+	PolicyStrict   = "strict"
+)
+
+// CancellationPolicies are the policies an item can have, items without one
+// are flexible.
+var CancellationPolicies = []string{PolicyFlexible, PolicyModerate, PolicyStrict}
+
+// refundTier refunds Percent of the rent cost when the renter cancels at
+// least HoursBefore the start.
+type refundTier struct {
+	HoursBefore int
+	Percent     int
+}
+
+// cancellationTiers are ordered from the earliest cancellation, a later one
+// gets no refund.
+var cancellationTiers = map[string][]refundTier{
+	PolicyFlexible: {{24, 100}, {0, 50}},
+	PolicyModerate: {{5 * 24, 100}, {24, 50}},
+	PolicyStrict:   {{14 * 24, 100}, {7 * 24, 50}},
+}
+
+// CancellationBreakdown is how the money of a cancelled rent is split, it
+// is stored on the rent. The deposit is always returned in full.
+type CancellationBreakdown struct {
+	Policy           string         `json:"policy"`
+	CancelledBy      string         `json:"cancelled_by"`
+	CancelledAt      types.DateTime `json:"cancelled_at"`
+	HoursBeforeStart int            `json:"hours_before_start"`
+	RentCost         float64        `json:"rent_cost"`
+	RefundPercent    int            `json:"refund_percent"`
+	Refund           float64        `json:"refund"`
+	Retained         float64        `json:"retained"`
+	Deposit          float64        `json:"deposit"`
+	Currency         string         `json:"currency"`
+}
+
+func isCancellationPolicy(policy string) bool {
+	for _, p := range CancellationPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// rentPolicy is the policy the rent was booked under.
+func rentPolicy(rent, item *core.Record) string {
+	for _, policy := range []string{rent.GetString("cancellation_policy"), item.GetString("cancellation_policy")} {
+		if isCancellationPolicy(policy) {
+			return policy
+		}
+	}
+	return PolicyFlexible
+}
+
+// rentCost is the rental amount of the rent; rents booked before the rate
+// tables cost the daily price per started day.
+func rentCost(rent, item *core.Record) float64 {
+	if amount := rent.GetFloat("amount"); amount > 0 {
+		return amount
+	}
+	start, end := rent.GetDateTime("date_start").Time(), rent.GetDateTime("date_end").Time()
+	days := math.Max(1, math.Ceil(end.Sub(start).Hours()/24))
+	return roundMoney(item.GetFloat("price") * days)
+}
+
+// refundPercent applies the tiers of the policy.
+func refundPercent(policy string, hoursBefore int) int {
+	for _, tier := range cancellationTiers[policy] {
+		if hoursBefore >= tier.HoursBefore {
+			return tier.Percent
+		}
+	}
+	return 0
+}
+
+// cancellationBreakdown splits the rent cost when party cancels at now. An
+// owner cancellation and a request the owner hasn't approved yet are
+// refunded in full.
+func cancellationBreakdown(rent, item *core.Record, status, party string, now time.Time) CancellationBreakdown {
+	policy := rentPolicy(rent, item)
+	cost := rentCost(rent, item)
+	hours := int(math.Floor(rent.GetDateTime("date_start").Time().Sub(now).Hours()))
+
+	percent := 100
+	if party == PartyRenter && status != StatusRequested {
+		percent = refundPercent(policy, hours)
+	}
+	refund := roundMoney(cost * float64(percent) / 100)
+
+	cancelledAt, _ := types.ParseDateTime(now)
+	return CancellationBreakdown{
+		Policy:           policy,
+		CancelledBy:      party,
+		CancelledAt:      cancelledAt,
+		HoursBeforeStart: hours,
+		RentCost:         cost,
+		RefundPercent:    percent,
+		Refund:           refund,
+		Retained:         roundMoney(cost - refund),
+		Deposit:          rent.GetFloat("deposit"),
+		Currency:         Currency,
+	}
+}
+
+// cancelRent stores the breakdown on the rent and counts the owner
+// cancellations. Must be called inside the transaction that cancels it.
+func cancelRent(txApp core.App, rent *core.Record, status, party string) error {
+	item, err := txApp.FindRecordById("items", rent.GetString("item"))
+	if err != nil {
+		return err
+	}
+
+	rent.Set("cancellation", cancellationBreakdown(rent, item, status, party, time.Now()))
+	if party != PartyOwner {
+		return nil
+	}
+	_, err = txApp.DB().Update(
+		"users",
+		dbx.Params{"owner_cancellations_count": dbx.NewExp("[[owner_cancellations_count]] + 1")},
+		dbx.HashExp{"id": item.GetString("author")},
+	).Execute()
+	return err
+}
+
+// PreviewCancellation tells the user what cancelling the rent right now
+// would refund.
+func PreviewCancellation(app core.App, rentID, userID string) (CancellationBreakdown, error) {
+	rent, err := app.FindRecordById("rents", rentID)
+	if err != nil {
+		return CancellationBreakdown{}, ErrRentNotFound
+	}
+	party, err := rentParty(app, rent, userID)
+	if err != nil {
+		return CancellationBreakdown{}, err
+	}
+	status := rentStatusName(app, rent)
+	if err := canTransition(status, StatusCancelled, party); err != nil {
+		return CancellationBreakdown{}, err
+	}
+	item, err := app.FindRecordById("items", rent.GetString("item"))
+	if err != nil {
+		return CancellationBreakdown{}, err
+	}
+
+	return cancellationBreakdown(rent, item, status, party, time.Now()), nil
+}
@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestRefundPercent(t *testing.T) {
+	scenarios := []struct {
+		policy      string
+		hoursBefore int
+		expected    int
+	}{
+		{PolicyFlexible, 48, 100},
+		{PolicyFlexible, 24, 100},
+		{PolicyFlexible, 23, 50},
+		{PolicyFlexible, 0, 50},
+		{PolicyFlexible, -1, 0},
+		{PolicyModerate, 5 * 24, 100},
+		{PolicyModerate, 5*24 - 1, 50},
+		{PolicyModerate, 24, 50},
+		{PolicyModerate, 23, 0},
+		{PolicyStrict, 14 * 24, 100},
+		{PolicyStrict, 14*24 - 1, 50},
+		{PolicyStrict, 7 * 24, 50},
+		{PolicyStrict, 7*24 - 1, 0},
+		{"unknown", 1000, 0},
+	}
+
+	for _, s := range scenarios {
+		if got := refundPercent(s.policy, s.hoursBefore); got != s.expected {
+			t.Errorf("refundPercent(%q, %d): expected %d, got %d", s.policy, s.hoursBefore, s.expected, got)
+		}
+	}
+}
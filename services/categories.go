@@ -0,0 +1,409 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Attribute types of the category schemas.
+const (
+	AttrNumber = "number"
+	AttrText   = "text"
+	AttrBool   = "bool"
+	AttrEnum   = "enum"
+)
+
+// maxCategoryDepth stops walking the parents of a broken (cyclic) tree.
+const maxCategoryDepth = 10
+
+var ErrCategoryNotFound = errors.New("category not found")
+
+// AttributeDef describes a typed item attribute of a category, it applies
+// to the subcategories as well.
+type AttributeDef struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	// Labels holds the kk/en translations of Label.
+	Labels   map[string]string `json:"labels,omitempty"`
+	Unit     string            `json:"unit,omitempty"`
+	Required bool              `json:"required,omitempty"`
+	Options  []string          `json:"options,omitempty"`
+	Min      *float64          `json:"min,omitempty"`
+	Max      *float64          `json:"max,omitempty"`
+}
+
+type CategoryCrumb struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type CategoryNode struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Parent     string          `json:"parent"`
+	Attributes []AttributeDef  `json:"attributes"`
+	Children   []*CategoryNode `json:"children"`
+}
+
+// AttributeFilter narrows items by an attribute: Values match exactly (any
+// of them), Min/Max bound number attributes.
+type AttributeFilter struct {
+	Key    string
+	Values []string
+	Min    *float64
+	Max    *float64
+}
+
+func categoryAttributeDefs(category *core.Record) []AttributeDef {
+	defs := []AttributeDef{}
+	_ = category.UnmarshalJSONField("attributes", &defs)
+	return defs
+}
+
+// categoryChain returns the category and its parents, root first.
+func categoryChain(app core.App, categoryID string) ([]*core.Record, error) {
+	chain := []*core.Record{}
+	seen := map[string]bool{}
+	for id := categoryID; id != "" && !seen[id] && len(chain) < maxCategoryDepth; {
+		seen[id] = true
+		category, err := app.FindRecordById("categories", id)
+		if err != nil {
+			if len(chain) == 0 {
+				return nil, ErrCategoryNotFound
+			}
+			break
+		}
+		chain = append(chain, category)
+		id = category.GetString("parent")
+	}
+	slices.Reverse(chain)
+	return chain, nil
+}
+
+// effectiveAttributes merges the schemas along the chain, a subcategory
+// overrides a parent attribute with the same key.
+func effectiveAttributes(chain []*core.Record) []AttributeDef {
+	defs := []AttributeDef{}
+	index := map[string]int{}
+	for _, category := range chain {
+		for _, def := range categoryAttributeDefs(category) {
+			if i, ok := index[def.Key]; ok {
+				defs[i] = def
+				continue
+			}
+			index[def.Key] = len(defs)
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+func categoryBreadcrumb(chain []*core.Record, lang string) []CategoryCrumb {
+	crumbs := make([]CategoryCrumb, len(chain))
+	for i, category := range chain {
+		name, _ := localized(category, "name", lang)
+		crumbs[i] = CategoryCrumb{ID: category.Id, Name: name}
+	}
+	return crumbs
+}
+
+// localizeAttributes sets Label to its translation in lang when there is one.
+func localizeAttributes(defs []AttributeDef, lang string) []AttributeDef {
+	for i, def := range defs {
+		if label := def.Labels[lang]; label != "" {
+			defs[i].Label = label
+		}
+	}
+	return defs
+}
+
+// CategoryTree returns all categories nested under their parents.
+func CategoryTree(app core.App, lang string) ([]*CategoryNode, error) {
+	categories, err := app.FindAllRecords("categories")
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(categories, func(a, b *core.Record) int {
+		nameA, _ := localized(a, "name", lang)
+		nameB, _ := localized(b, "name", lang)
+		return strings.Compare(nameA, nameB)
+	})
+
+	nodes := make(map[string]*CategoryNode, len(categories))
+	for _, c := range categories {
+		name, _ := localized(c, "name", lang)
+		nodes[c.Id] = &CategoryNode{
+			ID:         c.Id,
+			Name:       name,
+			Parent:     c.GetString("parent"),
+			Attributes: localizeAttributes(categoryAttributeDefs(c), lang),
+			Children:   []*CategoryNode{},
+		}
+	}
+
+	roots := []*CategoryNode{}
+	for _, c := range categories {
+		node := nodes[c.Id]
+		if parent, ok := nodes[node.Parent]; ok && node.Parent != node.ID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots, nil
+}
+
+// withSubcategories adds the descendants of the given categories.
+func withSubcategories(app core.App, categoryIDs []string) ([]string, error) {
+	if len(categoryIDs) == 0 {
+		return categoryIDs, nil
+	}
+
+	params := dbx.Params{"max_depth": maxCategoryDepth}
+	placeholders := make([]string, len(categoryIDs))
+	for i, id := range categoryIDs {
+		key := "category" + strconv.Itoa(i)
+		placeholders[i] = "{:" + key + "}"
+		params[key] = id
+	}
+
+	result := []string{}
+	err := app.DB().NewQuery(
+		"WITH RECURSIVE tree(id, depth) AS (" +
+			"SELECT [[id]], 0 FROM [[categories]] WHERE [[id]] IN (" + strings.Join(placeholders, ", ") + ")" +
+			" UNION SELECT [[categories.id]], tree.depth + 1 FROM [[categories]]" +
+			" INNER JOIN tree ON [[categories.parent]] = tree.id WHERE tree.depth < {:max_depth})" +
+			" SELECT DISTINCT id FROM tree",
+	).Bind(params).Column(&result)
+	if err != nil {
+		return nil, err
+	}
+	// unknown categories still filter, they match no items
+	if len(result) == 0 {
+		return categoryIDs, nil
+	}
+	return result, nil
+}
+
+// cleanItemAttributes validates raw attribute values against the schema and
+// returns them with canonical types. Problems are reported per attribute.
+func cleanItemAttributes(defs []AttributeDef, raw map[string]any) (map[string]any, ValidationError) {
+	errs := ValidationError{}
+	clean := map[string]any{}
+
+	known := map[string]bool{}
+	for _, def := range defs {
+		known[def.Key] = true
+		field := "attributes." + def.Key
+
+		value, ok := raw[def.Key]
+		if !ok || value == nil || value == "" {
+			if def.Required {
+				errs[field] = "cannot be blank"
+			}
+			continue
+		}
+
+		switch def.Type {
+		case AttrNumber:
+			n, ok := value.(float64)
+			if !ok {
+				errs[field] = "must be a number"
+				continue
+			}
+			if (def.Min != nil && n < *def.Min) || (def.Max != nil && n > *def.Max) {
+				errs[field] = "is out of range"
+				continue
+			}
+			clean[def.Key] = n
+		case AttrBool:
+			b, ok := value.(bool)
+			if !ok {
+				errs[field] = "must be true or false"
+				continue
+			}
+			clean[def.Key] = b
+		case AttrEnum:
+			s, ok := value.(string)
+			if !ok || !slices.Contains(def.Options, s) {
+				errs[field] = "must be one of " + strings.Join(def.Options, ", ")
+				continue
+			}
+			clean[def.Key] = s
+		default:
+			s, ok := value.(string)
+			if !ok {
+				errs[field] = "must be a string"
+				continue
+			}
+			if s = strings.TrimSpace(s); s != "" {
+				clean[def.Key] = s
+			}
+		}
+	}
+
+	for key := range raw {
+		if !known[key] {
+			errs["attributes."+key] = "is not an attribute of the category"
+		}
+	}
+
+	return clean, errs
+}
+
+// attributeDefsByKey collects the schemas of all categories, used to type
+// the attribute filters. Parents are walked before their subcategories so
+// that, like in effectiveAttributes, the subcategory definition wins.
+func attributeDefsByKey(app core.App) (map[string]AttributeDef, error) {
+	categories, err := app.FindAllRecords("categories")
+	if err != nil {
+		return nil, err
+	}
+	depths := categoryDepths(categories)
+	slices.SortStableFunc(categories, func(a, b *core.Record) int {
+		if d := depths[a.Id] - depths[b.Id]; d != 0 {
+			return d
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	defs := map[string]AttributeDef{}
+	for _, c := range categories {
+		for _, def := range categoryAttributeDefs(c) {
+			defs[def.Key] = def
+		}
+	}
+	return defs, nil
+}
+
+// categoryDepths returns how many parents each category has.
+func categoryDepths(categories []*core.Record) map[string]int {
+	parents := make(map[string]string, len(categories))
+	for _, c := range categories {
+		parents[c.Id] = c.GetString("parent")
+	}
+	depths := make(map[string]int, len(categories))
+	for _, c := range categories {
+		depth := 0
+		for id := parents[c.Id]; id != "" && depth < maxCategoryDepth; id = parents[id] {
+			depth++
+		}
+		depths[c.Id] = depth
+	}
+	return depths
+}
+
+// attributeExprs builds one condition per attribute filter.
+func attributeExprs(app core.App, filters []AttributeFilter) ([]dbx.Expression, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	defs, err := attributeDefsByKey(app)
+	if err != nil {
+		return nil, err
+	}
+
+	exprs := []dbx.Expression{}
+	for i, f := range filters {
+		param := "attr." + f.Key
+		def, ok := defs[f.Key]
+		if !ok {
+			return nil, ParamErrors{param: "unknown attribute"}
+		}
+
+		path := "attr_path" + strconv.Itoa(i)
+		value := "json_extract([[items.attributes]], {:" + path + "})"
+		params := dbx.Params{path: "$." + f.Key}
+
+		if (f.Min != nil || f.Max != nil) && def.Type != AttrNumber {
+			return nil, ParamErrors{param: "min/max apply to number attributes only"}
+		}
+		conds := []string{}
+		if f.Min != nil {
+			conds = append(conds, value+" >= {:attr_min"+strconv.Itoa(i)+"}")
+			params["attr_min"+strconv.Itoa(i)] = *f.Min
+		}
+		if f.Max != nil {
+			conds = append(conds, value+" <= {:attr_max"+strconv.Itoa(i)+"}")
+			params["attr_max"+strconv.Itoa(i)] = *f.Max
+		}
+
+		options := []string{}
+		for j, raw := range f.Values {
+			v, err := attributeValue(def, raw)
+			if err != nil {
+				return nil, ParamErrors{param: err.Error()}
+			}
+			key := "attr_v" + strconv.Itoa(i) + "_" + strconv.Itoa(j)
+			options = append(options, value+" = {:"+key+"}")
+			params[key] = v
+		}
+		if len(options) > 0 {
+			conds = append(conds, "("+strings.Join(options, " OR ")+")")
+		}
+
+		if len(conds) > 0 {
+			exprs = append(exprs, dbx.NewExp(strings.Join(conds, " AND "), params))
+		}
+	}
+	return exprs, nil
+}
+
+// attributeValue converts a query value to what json_extract returns.
+func attributeValue(def AttributeDef, raw string) (any, error) {
+	switch def.Type {
+	case AttrNumber:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, errors.New("must be a number")
+		}
+		return n, nil
+	case AttrBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	case AttrEnum:
+		if !slices.Contains(def.Options, raw) {
+			return nil, errors.New("must be one of " + strings.Join(def.Options, ", "))
+		}
+	}
+	return raw, nil
+}
+
+type CategoryDetails struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Parent     string          `json:"parent"`
+	Breadcrumb []CategoryCrumb `json:"breadcrumb"`
+	// Attributes include the ones inherited from the parents.
+	Attributes []AttributeDef `json:"attributes"`
+}
+
+func GetCategory(app core.App, id, lang string) (*CategoryDetails, error) {
+	chain, err := categoryChain(app, id)
+	if err != nil {
+		return nil, err
+	}
+	category := chain[len(chain)-1]
+	name, _ := localized(category, "name", lang)
+
+	return &CategoryDetails{
+		ID:         category.Id,
+		Name:       name,
+		Parent:     category.GetString("parent"),
+		Breadcrumb: categoryBreadcrumb(chain, lang),
+		Attributes: localizeAttributes(effectiveAttributes(chain), lang),
+	}, nil
+}
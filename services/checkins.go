@@ -0,0 +1,400 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Kinds of rent check-ins.
+const (
+	CheckinHandover = "handover"
+	CheckinReturn   = "return"
+)
+
+// Statuses of rent check-ins.
+const (
+	CheckinPending   = "pending"
+	CheckinConfirmed = "confirmed"
+)
+
+// CheckinCodeTTL is how long a QR code of a check-in can be scanned, the
+// owner's app asks for a fresh one when it runs out.
+const CheckinCodeTTL = 10 * time.Minute
+
+// checkinCodePrefix starts the text of every check-in QR code.
+const checkinCodePrefix = "uley-checkin"
+
+const (
+	checklistMax      = 30
+	checklistLabelMax = 100
+	checkinNoteMax    = 2000
+)
+
+const checkinSecretKey = "checkinSecret"
+
+var (
+	ErrCheckinNotFound     = errors.New("check-in not found")
+	ErrInvalidCheckinCode  = errors.New("invalid check-in code")
+	ErrCheckinCodeExpired  = errors.New("the check-in code has expired")
+	ErrCheckinConfirmed    = errors.New("the check-in is already confirmed")
+	errCheckinSecretLength = errors.New("CHECKIN_SECRET must be at least 32 characters")
+)
+
+// checkinStatuses are the rent statuses a check-in kind is made in and
+// moves the rent to once confirmed.
+var checkinStatuses = map[string][2]string{
+	CheckinHandover: {StatusApproved, StatusHandedOver},
+	CheckinReturn:   {StatusHandedOver, StatusReturned},
+}
+
+type ChecklistEntry struct {
+	Label string `json:"label"`
+	OK    bool   `json:"ok"`
+	Note  string `json:"note,omitempty"`
+}
+
+// CheckinInput is the multipart form of a check-in; Checklist is a JSON
+// array of ChecklistEntry, the photos come as files.
+type CheckinInput struct {
+	Kind         string   `form:"kind"`
+	Checklist    string   `form:"checklist"`
+	MeterReading *float64 `form:"meter_reading"`
+	MeterLabel   string   `form:"meter_label"`
+	Note         string   `form:"note"`
+}
+
+// CheckinCode is the signed text the owner's app shows as a QR code.
+type CheckinCode struct {
+	Code    string         `json:"code"`
+	Expires types.DateTime `json:"expires"`
+}
+
+// checkinSecret signs the QR codes. Without CHECKIN_SECRET a random one is
+// made at start, the codes live for minutes only.
+func checkinSecret(app core.App) ([]byte, error) {
+	secret := app.Store().GetOrSet(checkinSecretKey, func() any {
+		if env := os.Getenv("CHECKIN_SECRET"); env != "" {
+			return env
+		}
+		return security.RandomString(64)
+	}).(string)
+	if len(secret) < 32 {
+		return nil, errCheckinSecretLength
+	}
+	return []byte(secret), nil
+}
+
+func checkinSignature(secret []byte, checkin *core.Record, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s:%s:%s:%d", checkin.Id, checkin.GetString("rent"), checkin.GetString("kind"), expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signCheckin makes a QR code of the check-in valid for CheckinCodeTTL.
+func signCheckin(app core.App, checkin *core.Record, now time.Time) (CheckinCode, error) {
+	secret, err := checkinSecret(app)
+	if err != nil {
+		return CheckinCode{}, err
+	}
+	expires := now.Add(CheckinCodeTTL).Unix()
+	expiresAt, _ := types.ParseDateTime(time.Unix(expires, 0))
+
+	return CheckinCode{
+		Code:    fmt.Sprintf("%s:%s:%d:%s", checkinCodePrefix, checkin.Id, expires, checkinSignature(secret, checkin, expires)),
+		Expires: expiresAt,
+	}, nil
+}
+
+// verifyCheckinCode returns the check-in a scanned code is for.
+func verifyCheckinCode(app core.App, code string, now time.Time) (*core.Record, error) {
+	parts := strings.Split(strings.TrimSpace(code), ":")
+	if len(parts) != 4 || parts[0] != checkinCodePrefix {
+		return nil, ErrInvalidCheckinCode
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCheckinCode
+	}
+	checkin, err := app.FindRecordById("rent_checkins", parts[1])
+	if err != nil {
+		return nil, ErrInvalidCheckinCode
+	}
+
+	secret, err := checkinSecret(app)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(parts[3]), []byte(checkinSignature(secret, checkin, expires))) {
+		return nil, ErrInvalidCheckinCode
+	}
+	if now.Unix() > expires {
+		return nil, ErrCheckinCodeExpired
+	}
+	return checkin, nil
+}
+
+func parseChecklist(raw string) ([]ChecklistEntry, error) {
+	entries := []ChecklistEntry{}
+	if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+		return nil, ValidationError{"checklist": "must be a JSON array of {label, ok, note}"}
+	}
+	if len(entries) == 0 || len(entries) > checklistMax {
+		return nil, ValidationError{"checklist": fmt.Sprintf("must have between 1 and %d entries", checklistMax)}
+	}
+	for i := range entries {
+		entries[i].Label = strings.TrimSpace(entries[i].Label)
+		entries[i].Note = strings.TrimSpace(entries[i].Note)
+		if n := utf8.RuneCountInString(entries[i].Label); n == 0 || n > checklistLabelMax {
+			return nil, ValidationError{"checklist": fmt.Sprintf("every label must be between 1 and %d characters", checklistLabelMax)}
+		}
+		if utf8.RuneCountInString(entries[i].Note) > checklistLabelMax {
+			return nil, ValidationError{"checklist": fmt.Sprintf("every note must be at most %d characters", checklistLabelMax)}
+		}
+	}
+	return entries, nil
+}
+
+// findCheckin returns nil when the rent has no check-in of the kind yet.
+func findCheckin(app core.App, rentID, kind string) *core.Record {
+	checkin, err := app.FindFirstRecordByFilter(
+		"rent_checkins",
+		"rent = {:rent} && kind = {:kind}",
+		dbx.Params{"rent": rentID, "kind": kind},
+	)
+	if err != nil {
+		return nil
+	}
+	return checkin
+}
+
+// exportCheckin adds the photo URLs and, for a return, how far the meter
+// went since the handover.
+func exportCheckin(app core.App, checkin *core.Record) map[string]any {
+	result := checkin.PublicExport()
+	result["photos"] = protectedFileURLs(checkin, "photos")
+
+	if checkin.GetString("kind") == CheckinReturn {
+		handover := findCheckin(app, checkin.GetString("rent"), CheckinHandover)
+		if handover != nil && handover.GetFloat("meter_reading") > 0 && checkin.GetFloat("meter_reading") > 0 {
+			result["meter_delta"] = roundMoney(checkin.GetFloat("meter_reading") - handover.GetFloat("meter_reading"))
+		}
+	}
+	return result
+}
+
+// CreateCheckin records the condition of the item at pickup or return. A
+// pending check-in of the same kind is replaced. It returns the check-in
+// with the first QR code for the renter to scan.
+func CreateCheckin(app core.App, rentID, ownerID string, in CheckinInput, files []*filesystem.File) (map[string]any, error) {
+	rent, err := app.FindRecordById("rents", rentID)
+	if err != nil {
+		return nil, ErrRentNotFound
+	}
+	party, err := rentParty(app, rent, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if party != PartyOwner {
+		return nil, ErrWrongParty
+	}
+	statuses, ok := checkinStatuses[in.Kind]
+	if !ok {
+		return nil, ValidationError{"kind": "must be handover or return"}
+	}
+	if rentStatusName(app, rent) != statuses[0] {
+		return nil, ErrTransitionNotAllowed
+	}
+
+	checklist, err := parseChecklist(in.Checklist)
+	if err != nil {
+		return nil, err
+	}
+	errs := ValidationError{}
+	if in.MeterReading != nil && *in.MeterReading < 0 {
+		errs["meter_reading"] = "must not be negative"
+	}
+	if utf8.RuneCountInString(in.MeterLabel) > 50 {
+		errs["meter_label"] = "must be at most 50 characters"
+	}
+	if utf8.RuneCountInString(in.Note) > checkinNoteMax {
+		errs["note"] = fmt.Sprintf("must be at most %d characters", checkinNoteMax)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if in.Kind == CheckinReturn && in.MeterReading != nil {
+		handover := findCheckin(app, rent.Id, CheckinHandover)
+		if handover != nil && *in.MeterReading < handover.GetFloat("meter_reading") {
+			return nil, ValidationError{"meter_reading": "must not be lower than at the handover"}
+		}
+	}
+	photos, err := conditionPhotos(files, in.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	col, err := app.FindCollectionByNameOrId("rent_checkins")
+	if err != nil {
+		return nil, err
+	}
+	checkin := core.NewRecord(col)
+	checkin.Set("rent", rent.Id)
+	checkin.Set("kind", in.Kind)
+	checkin.Set("checklist", checklist)
+	checkin.Set("photos", photos)
+	if in.MeterReading != nil {
+		checkin.Set("meter_reading", *in.MeterReading)
+	}
+	checkin.Set("meter_label", strings.TrimSpace(in.MeterLabel))
+	checkin.Set("note", strings.TrimSpace(in.Note))
+	checkin.Set("created_by", ownerID)
+	checkin.Set("status", CheckinPending)
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		if existing := findCheckin(txApp, rent.Id, in.Kind); existing != nil {
+			if existing.GetString("status") == CheckinConfirmed {
+				return ErrCheckinConfirmed
+			}
+			if err := txApp.Delete(existing); err != nil {
+				return err
+			}
+		}
+		return txApp.Save(checkin)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := signCheckin(app, checkin, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	result := exportCheckin(app, checkin)
+	result["qr"] = code
+	return result, nil
+}
+
+// RentCheckins returns the check-ins of the rent to its parties.
+func RentCheckins(app core.App, rentID, userID string) ([]map[string]any, error) {
+	rent, err := app.FindRecordById("rents", rentID)
+	if err != nil {
+		return nil, ErrRentNotFound
+	}
+	if _, err := rentParty(app, rent, userID); err != nil {
+		return nil, err
+	}
+
+	records, err := app.FindRecordsByFilter("rent_checkins", "rent = {:rent}", "created", 0, 0, dbx.Params{"rent": rent.Id})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]map[string]any, len(records))
+	for i, r := range records {
+		list[i] = exportCheckin(app, r)
+	}
+	return list, nil
+}
+
+// CheckinQRCode signs a fresh QR code of a pending check-in for its owner.
+func CheckinQRCode(app core.App, checkinID, ownerID string) (CheckinCode, error) {
+	checkin, err := app.FindRecordById("rent_checkins", checkinID)
+	if err != nil {
+		return CheckinCode{}, ErrCheckinNotFound
+	}
+	rent, err := app.FindRecordById("rents", checkin.GetString("rent"))
+	if err != nil {
+		return CheckinCode{}, ErrRentNotFound
+	}
+	party, err := rentParty(app, rent, ownerID)
+	if err != nil {
+		return CheckinCode{}, err
+	}
+	if party != PartyOwner {
+		return CheckinCode{}, ErrWrongParty
+	}
+	if checkin.GetString("status") != CheckinPending {
+		return CheckinCode{}, ErrCheckinConfirmed
+	}
+
+	return signCheckin(app, checkin, time.Now())
+}
+
+// ConfirmCheckin is called with the code the renter scanned: the check-in
+// is confirmed and the rent is handed over or returned, with the time
+// recorded on it.
+func ConfirmCheckin(app core.App, code, renterID string) (map[string]any, error) {
+	now := time.Now()
+	checkin, err := verifyCheckinCode(app, code, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var rent *core.Record
+	var status string
+	err = app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		if checkin, err = txApp.FindRecordById("rent_checkins", checkin.Id); err != nil {
+			return ErrCheckinNotFound
+		}
+		if rent, err = txApp.FindRecordById("rents", checkin.GetString("rent")); err != nil {
+			return ErrRentNotFound
+		}
+		party, err := rentParty(txApp, rent, renterID)
+		if err != nil {
+			return err
+		}
+		if party != PartyRenter {
+			return ErrWrongParty
+		}
+		if checkin.GetString("status") != CheckinPending {
+			return ErrCheckinConfirmed
+		}
+
+		// the owner made the check-in, the renter's scan completes the move
+		statuses := checkinStatuses[checkin.GetString("kind")]
+		from := rentStatusName(txApp, rent)
+		if from != statuses[0] {
+			return ErrTransitionNotAllowed
+		}
+		status = statuses[1]
+		to, err := findStatus(txApp, status)
+		if err != nil {
+			return err
+		}
+		if err := prepareTransition(txApp, rent, from, status, PartyOwner, now); err != nil {
+			return err
+		}
+
+		confirmedAt, _ := types.ParseDateTime(now)
+		checkin.Set("status", CheckinConfirmed)
+		checkin.Set("confirmed_by", renterID)
+		checkin.Set("confirmed_at", confirmedAt)
+		if err := txApp.Save(checkin); err != nil {
+			return err
+		}
+		return setRentStatus(txApp, rent, to, renterID, checkin.GetString("kind")+" confirmed by QR code")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"checkin": exportCheckin(app, checkin),
+		"rent":    finishTransition(app, rent, status),
+	}, nil
+}
@@ -0,0 +1,446 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"uley_be/payments"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Statuses of damage claims.
+const (
+	ClaimOpen      = "open"
+	ClaimAccepted  = "accepted"
+	ClaimContested = "contested"
+	ClaimResolved  = "resolved"
+)
+
+// ClaimWindow is how long after the return the owner may claim damage,
+// the deposit is released when it passes without a claim.
+const ClaimWindow = 72 * time.Hour
+
+const claimDescriptionMax = 2000
+
+var (
+	ErrClaimWindowClosed   = errors.New("damage can only be claimed in the window after the return")
+	ErrDepositNotHeld      = errors.New("the rent has no held deposit")
+	ErrDamageClaimExists   = errors.New("the rent already has a damage claim")
+	ErrDamageClaimNotFound = errors.New("damage claim not found")
+	ErrDamageClaimNotOpen  = errors.New("the damage claim can't be changed in its current status")
+	ErrDamageClaimPending  = errors.New("the rent has an open damage claim")
+)
+
+type DamageClaimInput struct {
+	Amount      float64 `json:"amount" form:"amount"`
+	Description string  `json:"description" form:"description"`
+}
+
+// ClaimResponse is the renter's answer to a claim.
+type ClaimResponse struct {
+	Accept bool   `json:"accept"`
+	Note   string `json:"note"`
+}
+
+// ClaimResolution is the support's decision on a contested claim, Amount
+// is taken from the deposit.
+type ClaimResolution struct {
+	Amount float64 `json:"amount"`
+	Note   string  `json:"note"`
+}
+
+// startClaimWindow opens the damage claim window of a returned rent.
+func startClaimWindow(rent *core.Record, now time.Time) {
+	deadline, _ := types.ParseDateTime(now.Add(ClaimWindow))
+	rent.Set("claim_deadline", deadline)
+}
+
+func rentDamageClaim(app core.App, rentID string) (*core.Record, error) {
+	claim, err := app.FindFirstRecordByData("damage_claims", "rent", rentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return claim, err
+}
+
+// chargedDamageClaim returns the settled claim of the rent that took money
+// from the deposit, nil if there is none.
+func chargedDamageClaim(app core.App, rentID string) (*core.Record, error) {
+	claim, err := rentDamageClaim(app, rentID)
+	if err != nil || claim == nil {
+		return nil, err
+	}
+	switch claim.GetString("status") {
+	case ClaimAccepted, ClaimResolved:
+		if claim.GetFloat("charged_amount") > 0 {
+			return claim, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkNoOpenClaim keeps the owner from closing a rent with an unanswered
+// claim, closing releases the deposit.
+func checkNoOpenClaim(app core.App, rent *core.Record) error {
+	claim, err := rentDamageClaim(app, rent.Id)
+	if err != nil {
+		return err
+	}
+	if claim != nil && claim.GetString("status") == ClaimOpen {
+		return ErrDamageClaimPending
+	}
+	return nil
+}
+
+func exportDamageClaim(claim *core.Record) map[string]any {
+	result := claim.PublicExport()
+	result["photos"] = protectedFileURLs(claim, "photos")
+	return result
+}
+
+// FileDamageClaim lets the owner claim up to the deposit of a returned rent
+// while the claim window is open.
+func FileDamageClaim(app core.App, rentID, ownerID string, in DamageClaimInput, files []*filesystem.File) (map[string]any, error) {
+	rent, err := app.FindRecordById("rents", rentID)
+	if err != nil {
+		return nil, ErrRentNotFound
+	}
+	party, err := rentParty(app, rent, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if party != PartyOwner {
+		return nil, ErrWrongParty
+	}
+
+	deadline := rent.GetDateTime("claim_deadline")
+	if rentStatusName(app, rent) != StatusReturned || deadline.IsZero() || time.Now().After(deadline.Time()) {
+		return nil, ErrClaimWindowClosed
+	}
+	if rent.GetString("deposit_status") != payments.StatusHeld {
+		return nil, ErrDepositNotHeld
+	}
+
+	errs := ValidationError{}
+	deposit := rent.GetFloat("deposit")
+	if in.Amount <= 0 || in.Amount > deposit {
+		errs["amount"] = fmt.Sprintf("must be greater than 0 and at most the deposit of %.2f", deposit)
+	}
+	description := strings.TrimSpace(in.Description)
+	if description == "" || len([]rune(description)) > claimDescriptionMax {
+		errs["description"] = fmt.Sprintf("must be between 1 and %d characters", claimDescriptionMax)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	photos, err := conditionPhotos(files, "damage")
+	if err != nil {
+		return nil, err
+	}
+
+	col, err := app.FindCollectionByNameOrId("damage_claims")
+	if err != nil {
+		return nil, err
+	}
+	claim := core.NewRecord(col)
+	claim.Set("rent", rent.Id)
+	claim.Set("owner", ownerID)
+	claim.Set("renter", rent.GetString("renter"))
+	claim.Set("amount", roundMoney(in.Amount))
+	claim.Set("description", description)
+	claim.Set("photos", photos)
+	claim.Set("status", ClaimOpen)
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		existing, err := rentDamageClaim(txApp, rent.Id)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrDamageClaimExists
+		}
+		return txApp.Save(claim)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return exportDamageClaim(claim), nil
+}
+
+// GetRentDamageClaim returns the claim of the rent to its parties.
+func GetRentDamageClaim(app core.App, rentID, userID string) (map[string]any, error) {
+	rent, err := app.FindRecordById("rents", rentID)
+	if err != nil {
+		return nil, ErrRentNotFound
+	}
+	if _, err := rentParty(app, rent, userID); err != nil {
+		return nil, err
+	}
+
+	claim, err := rentDamageClaim(app, rent.Id)
+	if err != nil {
+		return nil, err
+	}
+	if claim == nil {
+		return nil, ErrDamageClaimNotFound
+	}
+	return exportDamageClaim(claim), nil
+}
+
+// chargeDamage takes the charged amount of the claim from the deposit hold
+// and releases the rest.
+func chargeDamage(app core.App, rent, claim *core.Record) error {
+	if amount := claim.GetFloat("charged_amount"); amount > 0 {
+		deposit, err := latestPayment(app, rent.Id, PaymentDeposit)
+		if err != nil {
+			return err
+		}
+		if deposit == nil || deposit.GetString("status") != payments.StatusHeld {
+			return ErrDepositNotHeld
+		}
+		provider, err := paymentProvider(app)
+		if err != nil {
+			return err
+		}
+		if _, err := provider.Capture(context.Background(), deposit.GetString("provider_id"), amount); err != nil {
+			return err
+		}
+	}
+	return releaseRentDeposit(app, rent)
+}
+
+// settleDamageClaim decides a claim that is still in status from and
+// closes its rent, then moves the deposit money. The claim and the rent are
+// read again inside the transaction, so of two concurrent decisions only
+// the first one passes. Like the status transitions, a provider failure is
+// logged and left for a retry.
+func settleDamageClaim(app core.App, claimID, from string, decide func(txApp core.App, claim, rent *core.Record) error, actorID, note string) (*core.Record, error) {
+	var claim, rent *core.Record
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		if claim, rent, err = findDamageClaim(txApp, claimID); err != nil {
+			return err
+		}
+		if claim.GetString("status") != from {
+			return ErrDamageClaimNotOpen
+		}
+		if err := decide(txApp, claim, rent); err != nil {
+			return err
+		}
+
+		closed, err := findStatus(txApp, StatusClosed)
+		if err != nil {
+			return err
+		}
+		if err := txApp.Save(claim); err != nil {
+			return err
+		}
+		return setRentStatus(txApp, rent, closed, actorID, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := chargeDamage(app, rent, claim); err != nil {
+		app.Logger().Error("charging the damage claim failed", "claim", claim.Id, "rent", rent.Id, "error", err.Error())
+	}
+	return claim, nil
+}
+
+func findDamageClaim(app core.App, claimID string) (*core.Record, *core.Record, error) {
+	claim, err := app.FindRecordById("damage_claims", claimID)
+	if err != nil {
+		return nil, nil, ErrDamageClaimNotFound
+	}
+	rent, err := app.FindRecordById("rents", claim.GetString("rent"))
+	if err != nil {
+		return nil, nil, ErrRentNotFound
+	}
+	return claim, rent, nil
+}
+
+// RespondDamageClaim lets the renter accept the claim, which pays it from
+// the deposit and closes the rent, or contest it, which opens a dispute.
+func RespondDamageClaim(app core.App, claimID, renterID string, in ClaimResponse) (map[string]any, error) {
+	claim, rent, err := findDamageClaim(app, claimID)
+	if err != nil {
+		return nil, err
+	}
+	party, err := rentParty(app, rent, renterID)
+	if err != nil {
+		return nil, err
+	}
+	if party != PartyRenter {
+		return nil, ErrWrongParty
+	}
+	if claim.GetString("status") != ClaimOpen {
+		return nil, ErrDamageClaimNotOpen
+	}
+
+	response := strings.TrimSpace(in.Note)
+	if in.Accept {
+		claim, err := settleDamageClaim(app, claimID, ClaimOpen, func(txApp core.App, claim, rent *core.Record) error {
+			claim.Set("response", response)
+			claim.Set("status", ClaimAccepted)
+			claim.Set("charged_amount", claim.GetFloat("amount"))
+			return nil
+		}, renterID, "damage claim accepted")
+		if err != nil {
+			return nil, err
+		}
+		return exportDamageClaim(claim), nil
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		if claim, rent, err = findDamageClaim(txApp, claimID); err != nil {
+			return err
+		}
+		if claim.GetString("status") != ClaimOpen {
+			return ErrDamageClaimNotOpen
+		}
+		disputed, err := findStatus(txApp, StatusDisputed)
+		if err != nil {
+			return err
+		}
+		claim.Set("response", response)
+		claim.Set("status", ClaimContested)
+		if err := txApp.Save(claim); err != nil {
+			return err
+		}
+		return setRentStatus(txApp, rent, disputed, renterID, "damage claim contested")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exportDamageClaim(claim), nil
+}
+
+// ResolveDamageClaim settles a contested claim with the amount the support
+// decided on, zero releases the whole deposit.
+func ResolveDamageClaim(app core.App, claimID string, in ClaimResolution) (map[string]any, error) {
+	claim, err := settleDamageClaim(app, claimID, ClaimContested, func(txApp core.App, claim, rent *core.Record) error {
+		if rentStatusName(txApp, rent) != StatusDisputed {
+			return ErrDamageClaimNotOpen
+		}
+		if in.Amount < 0 || in.Amount > claim.GetFloat("amount") {
+			return ValidationError{"amount": fmt.Sprintf("must be between 0 and the claimed %.2f", claim.GetFloat("amount"))}
+		}
+		claim.Set("status", ClaimResolved)
+		claim.Set("charged_amount", roundMoney(in.Amount))
+		claim.Set("resolution", strings.TrimSpace(in.Note))
+		return nil
+	}, "", "damage claim resolved")
+	if err != nil {
+		return nil, err
+	}
+	return exportDamageClaim(claim), nil
+}
+
+// DisputeResolution is the support's decision on a rent disputed without a
+// damage claim.
+type DisputeResolution struct {
+	Note string `json:"note"`
+}
+
+// ResolveRentDispute closes a disputed rent that has no damage claim and
+// releases its deposit. Contested claims go through ResolveDamageClaim.
+func ResolveRentDispute(app core.App, rentID string, in DisputeResolution) (map[string]any, error) {
+	var rent *core.Record
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		if rent, err = txApp.FindRecordById("rents", rentID); err != nil {
+			return ErrRentNotFound
+		}
+		if rentStatusName(txApp, rent) != StatusDisputed {
+			return ErrTransitionNotAllowed
+		}
+		claim, err := rentDamageClaim(txApp, rent.Id)
+		if err != nil {
+			return err
+		}
+		if claim != nil {
+			return ErrDamageClaimPending
+		}
+
+		closed, err := findStatus(txApp, StatusClosed)
+		if err != nil {
+			return err
+		}
+		note := strings.TrimSpace(in.Note)
+		if note == "" {
+			note = "dispute resolved"
+		}
+		return setRentStatus(txApp, rent, closed, "", note)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return finishTransition(app, rent, StatusClosed), nil
+}
+
+// ReleaseExpiredDeposits closes the returned rents whose claim window
+// passed without a claim and releases their deposits. It returns how many
+// rents were closed.
+func ReleaseExpiredDeposits(app core.App) (int, error) {
+	now, _ := types.ParseDateTime(time.Now())
+	ids := []string{}
+	err := app.DB().
+		Select("rents.id").
+		From("rents").
+		InnerJoin("statuses", dbx.NewExp("[[statuses.id]] = [[rents.status]]")).
+		Where(dbx.HashExp{"statuses.name": StatusReturned}).
+		AndWhere(dbx.NewExp("[[rents.claim_deadline]] != '' AND [[rents.claim_deadline]] < {:now}", dbx.Params{"now": now.String()})).
+		AndWhere(dbx.NewExp("NOT EXISTS (SELECT 1 FROM [[damage_claims]] WHERE [[damage_claims.rent]] = [[rents.id]])")).
+		Column(&ids)
+	if err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	for _, id := range ids {
+		var rent *core.Record
+		err := app.RunInTransaction(func(txApp core.App) error {
+			var err error
+			if rent, err = txApp.FindRecordById("rents", id); err != nil {
+				return err
+			}
+			// a claim may have come in since the lookup
+			claim, err := rentDamageClaim(txApp, rent.Id)
+			if err != nil {
+				return err
+			}
+			if claim != nil || rentStatusName(txApp, rent) != StatusReturned {
+				rent = nil
+				return nil
+			}
+			status, err := findStatus(txApp, StatusClosed)
+			if err != nil {
+				return err
+			}
+			return setRentStatus(txApp, rent, status, "", "damage claim window expired")
+		})
+		if err != nil {
+			return closed, err
+		}
+		if rent == nil {
+			continue
+		}
+		closed++
+
+		if err := settleRentPayments(app, rent, StatusClosed); err != nil {
+			app.Logger().Error("releasing the deposit failed", "rent", rent.Id, "error", err.Error())
+		}
+	}
+	return closed, nil
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"sort"
+	"strings"
+)
+
+// ValidationError holds field-level messages.
+type ValidationError map[string]string
+
+func (e ValidationError) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return "invalid fields: " + strings.Join(fields, ", ")
+}
+
+// ParamErrors maps a query parameter to what is wrong with it.
+type ParamErrors map[string]string
+
+func (e ParamErrors) Error() string {
+	parts := make([]string, 0, len(e))
+	for key, reason := range e {
+		parts = append(parts, key+": "+reason)
+	}
+	sort.Strings(parts)
+	return "invalid query: " + strings.Join(parts, "; ")
+}
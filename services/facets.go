@@ -0,0 +1,171 @@
+package services
+
+import (
+	"math"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	priceBucketsCount = 5
+	topTagsCount      = 10
+)
+
+type FacetCount struct {
+	Value string `db:"value" json:"value"`
+	Label string `db:"label" json:"label,omitempty"`
+	Count int    `db:"count" json:"count"`
+}
+
+type PriceBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+type ItemFacets struct {
+	Categories []FacetCount  `json:"categories"`
+	Locations  []FacetCount  `json:"locations"`
+	Prices     []PriceBucket `json:"prices"`
+	Tags       []FacetCount  `json:"tags"`
+}
+
+// facetQuery selects from items narrowed by the same conditions as the listing.
+func facetQuery(app core.App, resolver *core.RecordFieldResolver, where dbx.Expression, cols ...string) *dbx.SelectQuery {
+	q := app.DB().Select(cols...).From("items")
+	if where != nil {
+		q.AndWhere(where)
+	}
+	resolver.UpdateQuery(q)
+	return q
+}
+
+// categoryLabelSQL selects the category name in lang, falling back to the
+// base (Russian) name.
+func categoryLabelSQL(lang string) string {
+	if lang == "" || lang == DefaultLang || !slices.Contains(Languages, lang) {
+		return "COALESCE([[facet_category.name]], '') AS label"
+	}
+	return "COALESCE(NULLIF([[facet_category.name_" + lang + "]], ''), [[facet_category.name]], '') AS label"
+}
+
+func itemFacets(app core.App, resolver *core.RecordFieldResolver, where dbx.Expression, lang string) (*ItemFacets, error) {
+	facets := &ItemFacets{
+		Categories: []FacetCount{},
+		Locations:  []FacetCount{},
+		Prices:     []PriceBucket{},
+		Tags:       []FacetCount{},
+	}
+
+	err := facetQuery(app, resolver, where,
+		"items.category AS value",
+		categoryLabelSQL(lang),
+		"COUNT(DISTINCT items.id) AS count",
+	).
+		LeftJoin("categories facet_category", dbx.NewExp("[[facet_category.id]] = [[items.category]]")).
+		AndWhere(dbx.NewExp("[[items.category]] != ''")).
+		GroupBy("items.category").
+		OrderBy("count DESC", "label ASC").
+		All(&facets.Categories)
+	if err != nil {
+		return nil, err
+	}
+
+	err = facetQuery(app, resolver, where,
+		"items.location AS value",
+		"COUNT(DISTINCT items.id) AS count",
+	).
+		AndWhere(dbx.NewExp("[[items.location]] != ''")).
+		GroupBy("items.location").
+		OrderBy("count DESC", "value ASC").
+		All(&facets.Locations)
+	if err != nil {
+		return nil, err
+	}
+
+	if facets.Prices, err = priceHistogram(app, resolver, where); err != nil {
+		return nil, err
+	}
+
+	if facets.Tags, err = topTags(app, resolver, where); err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+// niceStep rounds v up to 1, 2 or 5 times a power of ten.
+func niceStep(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*exp {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+func priceHistogram(app core.App, resolver *core.RecordFieldResolver, where dbx.Expression) ([]PriceBucket, error) {
+	var bounds struct {
+		Min *float64 `db:"min"`
+		Max *float64 `db:"max"`
+	}
+	err := facetQuery(app, resolver, where, "MIN(items.price) AS min", "MAX(items.price) AS max").One(&bounds)
+	if err != nil {
+		return nil, err
+	}
+	if bounds.Min == nil || bounds.Max == nil {
+		return []PriceBucket{}, nil
+	}
+
+	step := niceStep((*bounds.Max - *bounds.Min) / priceBucketsCount)
+	start := math.Floor(*bounds.Min/step) * step
+	count := int((*bounds.Max-start)/step) + 1
+
+	rows := []struct {
+		Bucket int `db:"bucket"`
+		Count  int `db:"count"`
+	}{}
+	err = facetQuery(app, resolver, where,
+		"CAST(([[items.price]] - {:bucket_start}) / {:bucket_step} AS INTEGER) AS bucket",
+		"COUNT(DISTINCT items.id) AS count",
+	).
+		Bind(dbx.Params{"bucket_start": start, "bucket_step": step}).
+		GroupBy("bucket").
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]PriceBucket, count)
+	for i := range buckets {
+		buckets[i].From = start + float64(i)*step
+		buckets[i].To = start + float64(i+1)*step
+	}
+	for _, row := range rows {
+		i := min(max(row.Bucket, 0), count-1)
+		buckets[i].Count += row.Count
+	}
+
+	return buckets, nil
+}
+
+func topTags(app core.App, resolver *core.RecordFieldResolver, where dbx.Expression) ([]FacetCount, error) {
+	tags := []FacetCount{}
+	err := facetQuery(app, resolver, where,
+		"facet_tag.name AS value",
+		"COUNT(DISTINCT items.id) AS count",
+	).
+		InnerJoin("json_each(items.item_tags) facet_tag_ref", nil).
+		InnerJoin("tags facet_tag", dbx.NewExp("[[facet_tag.id]] = [[facet_tag_ref.value]]")).
+		GroupBy("facet_tag.id").
+		OrderBy("count DESC", "value ASC").
+		Limit(topTagsCount).
+		All(&tags)
+	return tags, err
+}
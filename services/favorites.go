@@ -0,0 +1,151 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// FavoriteState is the result of changing a favorite.
+type FavoriteState struct {
+	Item           string `json:"item"`
+	IsFavorite     bool   `json:"is_favorite"`
+	FavoritesCount int    `json:"favorites_count"`
+}
+
+type favoriteStats struct {
+	Item  string `db:"item"`
+	Count int    `db:"count"`
+	Mine  bool   `db:"mine"`
+}
+
+// itemFavorites counts the favorites of the items and tells which of them
+// the viewer has, all in one query.
+func itemFavorites(app core.App, viewerID string, itemIDs []string) (map[string]favoriteStats, error) {
+	result := map[string]favoriteStats{}
+	if len(itemIDs) == 0 {
+		return result, nil
+	}
+
+	ids := make([]any, len(itemIDs))
+	for i, id := range itemIDs {
+		ids[i] = id
+	}
+	rows := []favoriteStats{}
+	err := app.DB().
+		Select("item", "COUNT(*) AS count", "MAX([[user]] = {:viewer}) AS mine").
+		From("favorite_items").
+		Where(dbx.In("item", ids...)).
+		GroupBy("item").
+		Bind(dbx.Params{"viewer": viewerID}).
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		result[row.Item] = row
+	}
+	return result, nil
+}
+
+// setFavorites adds is_favorite and favorites_count to the exported items.
+func setFavorites(app core.App, viewerID string, records []*core.Record, exported []map[string]any) error {
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = r.Id
+	}
+	stats, err := itemFavorites(app, viewerID, ids)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range records {
+		s := stats[r.Id]
+		exported[i]["is_favorite"] = viewerID != "" && s.Mine
+		exported[i]["favorites_count"] = s.Count
+	}
+	return nil
+}
+
+func favoriteState(app core.App, userID, itemID string) (FavoriteState, error) {
+	stats, err := itemFavorites(app, userID, []string{itemID})
+	if err != nil {
+		return FavoriteState{}, err
+	}
+	s := stats[itemID]
+	return FavoriteState{Item: itemID, IsFavorite: s.Mine, FavoritesCount: s.Count}, nil
+}
+
+func findFavorite(app core.App, userID, itemID string) (*core.Record, error) {
+	favorite, err := app.FindFirstRecordByFilter(
+		"favorite_items",
+		"user = {:user} && item = {:item}",
+		dbx.Params{"user": userID, "item": itemID},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return favorite, nil
+}
+
+// changeFavorite adds or removes the item from the user's favorites, next
+// decides from whether it is a favorite now. The unique (user, item) index
+// guards against doubles.
+func changeFavorite(app core.App, userID, itemID string, next func(isFavorite bool) bool) (FavoriteState, error) {
+	err := app.RunInTransaction(func(txApp core.App) error {
+		if _, err := txApp.FindRecordById("items", itemID); err != nil {
+			return ErrItemNotFound
+		}
+
+		existing, err := findFavorite(txApp, userID, itemID)
+		if err != nil {
+			return err
+		}
+
+		favorite := next(existing != nil)
+		switch {
+		case favorite && existing == nil:
+			col, err := txApp.FindCollectionByNameOrId("favorite_items")
+			if err != nil {
+				return err
+			}
+			record := core.NewRecord(col)
+			record.Set("user", userID)
+			record.Set("item", itemID)
+			return txApp.Save(record)
+		case !favorite && existing != nil:
+			return txApp.Delete(existing)
+		}
+		return nil
+	})
+	if err != nil {
+		return FavoriteState{}, err
+	}
+	return favoriteState(app, userID, itemID)
+}
+
+func AddFavorite(app core.App, userID, itemID string) (FavoriteState, error) {
+	return changeFavorite(app, userID, itemID, func(bool) bool { return true })
+}
+
+func RemoveFavorite(app core.App, userID, itemID string) (FavoriteState, error) {
+	return changeFavorite(app, userID, itemID, func(bool) bool { return false })
+}
+
+func ToggleFavorite(app core.App, userID, itemID string) (FavoriteState, error) {
+	return changeFavorite(app, userID, itemID, func(isFavorite bool) bool { return !isFavorite })
+}
+
+// favoritesOfExpr matches the items the user has in their favorites.
+func favoritesOfExpr(userID string) dbx.Expression {
+	return dbx.NewExp(
+		"EXISTS (SELECT 1 FROM [[favorite_items]] WHERE [[favorite_items.item]] = [[items.id]] AND [[favorite_items.user]] = {:favorites_of})",
+		dbx.Params{"favorites_of": userID},
+	)
+}
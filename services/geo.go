@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"math"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	earthRadiusKm = 6371.0
+	kmPerDegree   = 111.045
+
+	// sortDistance orders items by distance from the lat/lng point.
+	sortDistance = "distance"
+)
+
+var ErrDistanceNeedsPoint = errors.New("lat and lng are required for distance search")
+
+// haversineSQL is the great-circle distance in km from {:geo_lat}/{:geo_lng}.
+const haversineSQL = "(2 * 6371.0 * asin(sqrt(" +
+	"pow(sin(radians([[items.latitude]] - {:geo_lat}) / 2), 2) + " +
+	"cos(radians({:geo_lat})) * cos(radians([[items.latitude]])) * " +
+	"pow(sin(radians([[items.longitude]] - {:geo_lng}) / 2), 2))))"
+
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+func geoParams(lat, lng float64) dbx.Params {
+	return dbx.Params{"geo_lat": lat, "geo_lng": lng}
+}
+
+// hasCoordinates treats 0/0 as "not set", number fields can't be null.
+func hasCoordinates(record *core.Record) bool {
+	return record.GetFloat("latitude") != 0 || record.GetFloat("longitude") != 0
+}
+
+// radiusExpr matches items within radiusKm, the bounding box lets the
+// coordinates index cut most of the rows before the exact distance check.
+func radiusExpr(lat, lng, radiusKm float64) dbx.Expression {
+	dLat := radiusKm / kmPerDegree
+	dLng := radiusKm / (kmPerDegree * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+
+	params := geoParams(lat, lng)
+	params["geo_radius"] = radiusKm
+	params["geo_min_lat"] = lat - dLat
+	params["geo_max_lat"] = lat + dLat
+	params["geo_min_lng"] = lng - dLng
+	params["geo_max_lng"] = lng + dLng
+
+	return dbx.NewExp(
+		"[[items.latitude]] BETWEEN {:geo_min_lat} AND {:geo_max_lat}"+
+			" AND [[items.longitude]] BETWEEN {:geo_min_lng} AND {:geo_max_lng}"+
+			" AND "+haversineSQL+" <= {:geo_radius}",
+		params,
+	)
+}
+
+// orderByDistance sorts nearest first (farthest with desc), items without
+// coordinates go last either way.
+func orderByDistance(q *dbx.SelectQuery, lat, lng float64, desc bool) {
+	q.AndBind(geoParams(lat, lng))
+	q.AndOrderBy("([[items.latitude]] = 0 AND [[items.longitude]] = 0) ASC").
+		AndOrderBy(haversineSQL + sortDirection(desc))
+}
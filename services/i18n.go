@@ -0,0 +1,84 @@
+package services
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Content languages. Russian is the base one: it lives in the plain fields
+// (title, name), translations in the suffixed ones (title_kk, title_en).
+const (
+	LangRu = "ru"
+	LangKk = "kk"
+	LangEn = "en"
+
+	DefaultLang = LangRu
+)
+
+var Languages = []string{LangRu, LangKk, LangEn}
+
+// langFallbacks is the order translations are tried in for each language.
+var langFallbacks = map[string][]string{
+	LangRu: {LangRu, LangKk, LangEn},
+	LangKk: {LangKk, LangRu, LangEn},
+	LangEn: {LangEn, LangRu, LangKk},
+}
+
+// ResolveLang picks the language from the lang parameter, then from the
+// Accept-Language header, falling back to DefaultLang.
+func ResolveLang(param, acceptLanguage string) string {
+	if param = strings.ToLower(strings.TrimSpace(param)); slices.Contains(Languages, param) {
+		return param
+	}
+	// the header is usually sorted by preference already
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if slices.Contains(Languages, base) {
+			return base
+		}
+	}
+	return DefaultLang
+}
+
+// translatedField is the name of the field holding field in lang.
+func translatedField(field, lang string) string {
+	if lang == DefaultLang {
+		return field
+	}
+	return field + "_" + lang
+}
+
+// localized returns the best available translation of the field and the
+// language it is in.
+func localized(record *core.Record, field, lang string) (string, string) {
+	chain, ok := langFallbacks[lang]
+	if !ok {
+		chain = langFallbacks[DefaultLang]
+	}
+	for _, l := range chain {
+		if v := record.GetString(translatedField(field, l)); strings.TrimSpace(v) != "" {
+			return v, l
+		}
+	}
+	return record.GetString(field), DefaultLang
+}
+
+// localizeItem puts the translated title and description into the exported
+// item, "lang" tells which language the title ended up in.
+func localizeItem(item *core.Record, exported map[string]any, lang string) {
+	title, titleLang := localized(item, "title", lang)
+	exported["title"] = title
+	exported["lang"] = titleLang
+	exported["description"], _ = localized(item, "description", lang)
+
+	if expand, ok := exported["expand"].(map[string]any); ok {
+		if category := item.ExpandedOne("category"); category != nil {
+			export := category.PublicExport()
+			export["name"], _ = localized(category, "name", lang)
+			expand["category"] = export
+		}
+	}
+}
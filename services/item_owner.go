@@ -0,0 +1,319 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	itemTitleMin = 3
+	itemTitleMax = 120
+	itemTagsMax  = 20
+)
+
+var (
+	ErrNotItemOwner = errors.New("you are not the owner of this item")
+	ErrItemHasRents = errors.New("item has rents and can't be deleted")
+)
+
+// saveError converts the record validation errors into a ValidationError.
+func saveError(err error) error {
+	var verrs validation.Errors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+	result := ValidationError{}
+	for field, ferr := range verrs {
+		result[field] = ferr.Error()
+	}
+	return result
+}
+
+// ItemInput is the owner editable part of an item, nil fields are left as is.
+type ItemInput struct {
+	Title   *string `json:"title"`
+	TitleKk *string `json:"title_kk"`
+	TitleEn *string `json:"title_en"`
+	// Price is the daily rate for clients without the rate table.
+	Price          *float64 `json:"price"`
+	PriceHourly    *float64 `json:"price_hourly"`
+	PriceDaily     *float64 `json:"price_daily"`
+	PriceWeekly    *float64 `json:"price_weekly"`
+	PriceMonthly   *float64 `json:"price_monthly"`
+	Deposit        *float64 `json:"deposit"`
+	MinRentalHours *int     `json:"min_rental_hours"`
+	MaxRentalHours *int     `json:"max_rental_hours"`
+	// CancellationPolicy is one of CancellationPolicies.
+	CancellationPolicy *string  `json:"cancellation_policy"`
+	Description        *string  `json:"description"`
+	DescriptionKk      *string  `json:"description_kk"`
+	DescriptionEn      *string  `json:"description_en"`
+	Location           *string  `json:"location"`
+	Tags               *string  `json:"tags"`
+	Category           *string  `json:"category"`
+	Latitude           *float64 `json:"latitude"`
+	Longitude          *float64 `json:"longitude"`
+	// Attributes replace the category attribute values as a whole.
+	Attributes map[string]any `json:"attributes"`
+}
+
+func (in ItemInput) apply(item *core.Record) {
+	if in.Title != nil {
+		item.Set("title", strings.TrimSpace(*in.Title))
+	}
+	if in.TitleKk != nil {
+		item.Set("title_kk", strings.TrimSpace(*in.TitleKk))
+	}
+	if in.TitleEn != nil {
+		item.Set("title_en", strings.TrimSpace(*in.TitleEn))
+	}
+	if in.Price != nil {
+		item.Set("price", *in.Price)
+		if in.PriceDaily == nil {
+			item.Set("price_daily", *in.Price)
+		}
+	}
+	rates := map[string]*float64{
+		"price_hourly":  in.PriceHourly,
+		"price_daily":   in.PriceDaily,
+		"price_weekly":  in.PriceWeekly,
+		"price_monthly": in.PriceMonthly,
+		"deposit":       in.Deposit,
+	}
+	for field, v := range rates {
+		if v != nil {
+			item.Set(field, *v)
+		}
+	}
+	if in.MinRentalHours != nil {
+		item.Set("min_rental_hours", *in.MinRentalHours)
+	}
+	if in.MaxRentalHours != nil {
+		item.Set("max_rental_hours", *in.MaxRentalHours)
+	}
+	if in.CancellationPolicy != nil {
+		item.Set("cancellation_policy", *in.CancellationPolicy)
+	}
+	if in.Description != nil {
+		item.Set("description", SanitizeHTML(*in.Description))
+	}
+	if in.DescriptionKk != nil {
+		item.Set("description_kk", SanitizeHTML(*in.DescriptionKk))
+	}
+	if in.DescriptionEn != nil {
+		item.Set("description_en", SanitizeHTML(*in.DescriptionEn))
+	}
+	if in.Location != nil {
+		item.Set("location", strings.TrimSpace(*in.Location))
+	}
+	if in.Tags != nil {
+		item.Set("tags", strings.TrimSpace(*in.Tags))
+	}
+	if in.Category != nil {
+		item.Set("category", *in.Category)
+	}
+	if in.Latitude != nil {
+		item.Set("latitude", *in.Latitude)
+	}
+	if in.Longitude != nil {
+		item.Set("longitude", *in.Longitude)
+	}
+	if in.Attributes != nil {
+		item.Set("attributes", in.Attributes)
+	}
+}
+
+func validateItem(app core.App, item *core.Record) error {
+	errs := ValidationError{}
+
+	if n := utf8.RuneCountInString(item.GetString("title")); n < itemTitleMin || n > itemTitleMax {
+		errs["title"] = fmt.Sprintf("must be between %d and %d characters", itemTitleMin, itemTitleMax)
+	}
+	// translations are optional but follow the same length rules
+	for _, field := range []string{"title_kk", "title_en"} {
+		if n := utf8.RuneCountInString(item.GetString(field)); n > 0 && (n < itemTitleMin || n > itemTitleMax) {
+			errs[field] = fmt.Sprintf("must be between %d and %d characters", itemTitleMin, itemTitleMax)
+		}
+	}
+	for _, field := range []string{"price_hourly", "price_daily", "price_weekly", "price_monthly", "deposit"} {
+		if item.GetFloat(field) < 0 {
+			errs[field] = "must not be negative"
+		}
+	}
+	if len(itemRates(item)) == 0 {
+		errs["price"] = "must be greater than 0"
+	}
+	minHours, maxHours := item.GetInt("min_rental_hours"), item.GetInt("max_rental_hours")
+	if minHours < 0 {
+		errs["min_rental_hours"] = "must not be negative"
+	}
+	if maxHours < 0 || (maxHours > 0 && maxHours < minHours) {
+		errs["max_rental_hours"] = "must be 0 (no limit) or at least min_rental_hours"
+	}
+	if policy := item.GetString("cancellation_policy"); policy != "" && !isCancellationPolicy(policy) {
+		errs["cancellation_policy"] = "must be one of " + strings.Join(CancellationPolicies, ", ")
+	}
+	if plainText(item.GetString("description")) == "" {
+		errs["description"] = "cannot be blank"
+	}
+	if item.GetString("location") == "" {
+		errs["location"] = "cannot be blank"
+	}
+	if tags := NormalizeTags(item.GetString("tags")); len(tags) > itemTagsMax {
+		errs["tags"] = fmt.Sprintf("must have at most %d tags", itemTagsMax)
+	} else {
+		for _, tag := range tags {
+			if utf8.RuneCountInString(tag) > tagNameMax {
+				errs["tags"] = fmt.Sprintf("each tag must be at most %d characters", tagNameMax)
+				break
+			}
+		}
+	}
+	if id := item.GetString("category"); id != "" {
+		chain, err := categoryChain(app, id)
+		if err != nil {
+			errs["category"] = "unknown category"
+		} else {
+			raw := map[string]any{}
+			_ = item.UnmarshalJSONField("attributes", &raw)
+			attributes, attrErrs := cleanItemAttributes(effectiveAttributes(chain), raw)
+			for field, msg := range attrErrs {
+				errs[field] = msg
+			}
+			item.Set("attributes", attributes)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// SetItemFlags computes the derived item fields.
+func SetItemFlags(app core.App, item *core.Record) {
+	hasPhotos := len(item.GetStringSlice("photos")) > 0
+	if !hasPhotos && item.Id != "" {
+		// photos may also point to the item through item_photos.item
+		n, _ := app.CountRecords("item_photos", dbx.HashExp{"item": item.Id})
+		hasPhotos = n > 0
+	}
+	item.Set("has_photos", hasPhotos)
+}
+
+func findOwnItem(app core.App, itemID, ownerID string) (*core.Record, error) {
+	item, err := app.FindRecordById("items", itemID)
+	if err != nil {
+		return nil, ErrItemNotFound
+	}
+	if item.GetString("author") != ownerID {
+		return nil, ErrNotItemOwner
+	}
+	return item, nil
+}
+
+func exportItem(app core.App, item *core.Record, viewerID, lang string) (map[string]any, error) {
+	_ = app.ExpandRecord(item, []string{"category", "photos"}, nil)
+
+	result := item.PublicExport()
+	result["photos"] = exportPhotos(item.ExpandedAll("photos"))
+	localizeItem(item, result, lang)
+	result["breadcrumb"] = []CategoryCrumb{}
+	if chain, err := categoryChain(app, item.GetString("category")); err == nil {
+		result["breadcrumb"] = categoryBreadcrumb(chain, lang)
+	}
+	if expand, ok := result["expand"].(map[string]any); ok {
+		delete(expand, "photos")
+	}
+	if err := setPublicAuthors(app, viewerID, []*core.Record{item}, []map[string]any{result}); err != nil {
+		return nil, err
+	}
+	if err := setFavorites(app, viewerID, []*core.Record{item}, []map[string]any{result}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func CreateItem(app core.App, ownerID string, in ItemInput, lang string) (map[string]any, error) {
+	itemsCol, err := app.FindCollectionByNameOrId("items")
+	if err != nil {
+		return nil, err
+	}
+
+	item := core.NewRecord(itemsCol)
+	in.apply(item)
+	item.Set("author", ownerID)
+
+	if err := validateItem(app, item); err != nil {
+		return nil, err
+	}
+	if err := app.Save(item); err != nil {
+		return nil, saveError(err)
+	}
+
+	return exportItem(app, item, ownerID, lang)
+}
+
+func UpdateItem(app core.App, itemID, ownerID string, in ItemInput, lang string) (map[string]any, error) {
+	item, err := findOwnItem(app, itemID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	in.apply(item)
+
+	if err := validateItem(app, item); err != nil {
+		return nil, err
+	}
+	if err := app.Save(item); err != nil {
+		return nil, saveError(err)
+	}
+
+	return exportItem(app, item, ownerID, lang)
+}
+
+func DeleteItem(app core.App, itemID, ownerID string) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		item, err := findOwnItem(txApp, itemID, ownerID)
+		if err != nil {
+			return err
+		}
+
+		// rents keep a required reference to the item
+		rentsCount, err := txApp.CountRecords("rents", dbx.HashExp{"item": item.Id})
+		if err != nil {
+			return err
+		}
+		if rentsCount > 0 {
+			return ErrItemHasRents
+		}
+
+		photos, err := txApp.FindAllRecords("item_photos", dbx.HashExp{"item": item.Id})
+		if err != nil {
+			return err
+		}
+		for _, p := range photos {
+			if err := txApp.Delete(p); err != nil {
+				return err
+			}
+		}
+
+		favorites, err := txApp.FindAllRecords("favorite_items", dbx.HashExp{"item": item.Id})
+		if err != nil {
+			return err
+		}
+		for _, f := range favorites {
+			if err := txApp.Delete(f); err != nil {
+				return err
+			}
+		}
+
+		return txApp.Delete(item)
+	})
+}
@@ -1,79 +1,424 @@
 package services
 
 import (
+	"database/sql"
+	"errors"
+	"math"
+	"strconv"
 	"strings"
 
+	"uley_be/gazetteer"
+
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// sortRelevance orders search results by bm25, it's the default when searching.
+const sortRelevance = "relevance"
+
+// Match modes of the items filter.
+const (
+	MatchAll = "all"
+	MatchAny = "any"
 )
 
 type ItemsFilter struct {
-	MaxPrice   *float64
 	Location   string
+	LocationID string
 	Search     string
-	CategoryID string
 	Limit      int
 	Offset     int
 	Sort       string
+	Page       int
+
+	// CursorMode switches to keyset pagination on created/price,
+	// Cursor is the nextCursor of the previous page ("" for the first one).
+	CursorMode bool
+	Cursor     string
+
+	// Lat/Lng enable distance_km in the results and sort=distance,
+	// RadiusKm > 0 also limits the results to that radius.
+	Lat      *float64
+	Lng      *float64
+	RadiusKm float64
+
+	// Facets adds per-category/location/price/tag counts for the filter.
+	Facets bool
+
+	// AvailableFrom/AvailableTo leave out items booked for these dates.
+	AvailableFrom types.DateTime
+	AvailableTo   types.DateTime
+
+	// Attribute filters, combined with AND (Match "all", the default) or
+	// OR (Match "any"). Search, location, radius and availability always
+	// narrow the result.
+	MinPrice    *float64
+	MaxPrice    *float64
+	CategoryIDs []string
+	// Tags are matched exactly against the normalized item tags, an item
+	// needs any of them or all of them with TagsMatch "all".
+	Tags      []string
+	TagsMatch string
+	HasPhotos *bool
+	AuthorIDs []string
+	// Attributes filter by the typed category attributes.
+	Attributes []AttributeFilter
+	Match      string
+
+	// Lang is the preferred content language, see ResolveLang.
+	Lang string
+
+	// FavoritesOf limits the listing to the user's favorites, most recently
+	// added first unless Sort is set.
+	FavoritesOf string
+
+	// ViewerID is the authenticated user ("" for guests); it decides
+	// whether author contacts are included and sets is_favorite.
+	ViewerID string
 }
 
 type ItemsResponse struct {
-	Items []map[string]any `json:"items"`
-	Total int              `json:"total"`
+	Items      []map[string]any `json:"items"`
+	Total      int              `json:"total"`
+	Page       int              `json:"page"`
+	PerPage    int              `json:"perPage"`
+	TotalPages int              `json:"totalPages"`
+	HasMore    bool             `json:"hasMore"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+	Facets     *ItemFacets      `json:"facets,omitempty"`
 }
 
-func ListItems(app core.App, f ItemsFilter) (ItemsResponse, error) {
+// itemsWhere resolves the filter into conditions on the items table.
+func itemsWhere(app core.App, resolver *core.RecordFieldResolver, f ItemsFilter) (dbx.Expression, error) {
+	parts := []string{}
+	params := dbx.Params{}
+
+	locationID := strings.TrimSpace(f.LocationID)
+	if v := strings.TrimSpace(f.Location); v != "" && locationID == "" {
+		// known places are matched by id, so spelling doesn't matter
+		if loc, ok := gazetteer.Resolve(v); ok {
+			locationID = loc.ID
+		} else {
+			parts = append(parts, "location ~ {:location}")
+			params["location"] = v
+		}
+	}
+
+	exprs := []dbx.Expression{}
+
+	if len(parts) > 0 {
+		expr, err := search.FilterData(strings.Join(parts, " && ")).BuildExpr(resolver, params)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+
+	attrs, err := itemAttributesExpr(app, resolver, f)
+	if err != nil {
+		return nil, err
+	}
+	if attrs != nil {
+		exprs = append(exprs, attrs)
+	}
+
+	if locationID != "" {
+		exprs = append(exprs, locationIDExpr(locationID))
+	}
+
+	if f.FavoritesOf != "" {
+		exprs = append(exprs, favoritesOfExpr(f.FavoritesOf))
+	}
+
+	if query := ftsQuery(f.Search); query != "" {
+		exprs = append(exprs, searchMatchExpr(query))
+	}
+
+	if f.Lat != nil && f.Lng != nil && f.RadiusKm > 0 {
+		exprs = append(exprs, radiusExpr(*f.Lat, *f.Lng, f.RadiusKm))
+	}
+
+	if !f.AvailableFrom.IsZero() || !f.AvailableTo.IsZero() {
+		start, end := bookingWindow(f.AvailableFrom, f.AvailableTo)
+		exprs = append(exprs, notBookedExpr(start, end))
+	}
+
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+
+	return dbx.And(exprs...), nil
+}
+
+// itemAttributesExpr combines the price, category, tags, photos, author and
+// category attribute filters according to f.Match.
+func itemAttributesExpr(app core.App, resolver *core.RecordFieldResolver, f ItemsFilter) (dbx.Expression, error) {
 	parts := []string{}
 	params := dbx.Params{}
 
+	// a price range is a single condition for the match mode
+	priceParts := []string{}
+	if f.MinPrice != nil {
+		priceParts = append(priceParts, "price >= {:min_price}")
+		params["min_price"] = *f.MinPrice
+	}
 	if f.MaxPrice != nil {
-		parts = append(parts, "price <= {:max_price}")
+		priceParts = append(priceParts, "price <= {:max_price}")
 		params["max_price"] = *f.MaxPrice
 	}
-	if v := strings.TrimSpace(f.Location); v != "" {
-		parts = append(parts, "location ~ {:location}")
-		params["location"] = v
+	if len(priceParts) > 0 {
+		parts = append(parts, "("+strings.Join(priceParts, " && ")+")")
+	}
+	// a category matches the items of its subcategories too
+	categoryIDs, err := withSubcategories(app, f.CategoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	if cond := anyOf("category", categoryIDs, params); cond != "" {
+		parts = append(parts, cond)
+	}
+	if f.HasPhotos != nil {
+		parts = append(parts, "has_photos = {:has_photos}")
+		params["has_photos"] = *f.HasPhotos
+	}
+	if cond := anyOf("author", f.AuthorIDs, params); cond != "" {
+		parts = append(parts, cond)
+	}
+
+	exprs := []dbx.Expression{}
+	for _, part := range parts {
+		expr, err := search.FilterData(part).BuildExpr(resolver, params)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	if tags := normalizeTagList(f.Tags); len(tags) > 0 {
+		exprs = append(exprs, tagsExpr(tags, f.TagsMatch == MatchAll))
+	}
+	attrExprs, err := attributeExprs(app, f.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	exprs = append(exprs, attrExprs...)
+
+	switch {
+	case len(exprs) == 0:
+		return nil, nil
+	case f.Match == MatchAny:
+		return dbx.Or(exprs...), nil
+	default:
+		return dbx.And(exprs...), nil
+	}
+}
+
+// anyOf builds "(field = {:field0} || field = {:field1} ...)" for the values.
+func anyOf(field string, values []string, params dbx.Params) string {
+	conds := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		param := field + strconv.Itoa(len(conds))
+		conds = append(conds, field+" = {:"+param+"}")
+		params[param] = v
 	}
-	if v := strings.TrimSpace(f.Search); v != "" {
-		parts = append(parts, "(title ~ {:search} || description ~ {:search} || tags ~ {:search})")
-		params["search"] = v
+	if len(conds) == 0 {
+		return ""
 	}
-	if v := strings.TrimSpace(f.CategoryID); v != "" {
-		parts = append(parts, "category = {:category}")
-		params["category"] = v
+	return "(" + strings.Join(conds, " || ") + ")"
+}
+
+func normalizeTagList(tags []string) []string {
+	return NormalizeTags(strings.Join(tags, ","))
+}
+
+func ListItems(app core.App, f ItemsFilter) (ItemsResponse, error) {
+	col, err := app.FindCollectionByNameOrId("items")
+	if err != nil {
+		return ItemsResponse{}, err
 	}
 
-	filter := strings.Join(parts, " && ")
+	searchQuery := ftsQuery(f.Search)
 
 	sort := f.Sort
+	if sort == "" && searchQuery != "" {
+		sort = sortRelevance + ",-" + sortCreated
+	}
 	if sort == "" {
-		sort = "-created"
+		sort = "-" + sortCreated
 	}
+	sorts, err := parseItemSorts(sort)
+	if err != nil {
+		return ItemsResponse{}, err
+	}
+
+	resolver := core.NewRecordFieldResolver(app, col, nil, true)
 
-	records, err := app.FindRecordsByFilter("items", filter, sort, f.Limit, f.Offset, params)
+	where, err := itemsWhere(app, resolver, f)
 	if err != nil {
 		return ItemsResponse{}, err
 	}
 
-	_ = app.ExpandRecords(records, []string{"category", "author", "photos"}, nil)
+	// count before sorting so that only the filter joins are attached
+	total := 0
+	countQ := app.RecordQuery(col).Select("COUNT(DISTINCT [[items.id]])")
+	if where != nil {
+		countQ.AndWhere(where)
+	}
+	resolver.UpdateQuery(countQ)
+	if err := countQ.Row(&total); err != nil {
+		return ItemsResponse{}, err
+	}
+
+	var facets *ItemFacets
+	if f.Facets {
+		if facets, err = itemFacets(app, resolver, where, f.Lang); err != nil {
+			return ItemsResponse{}, err
+		}
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultItemsLimit
+	}
+	limit = min(limit, MaxItemsLimit)
+
+	q := app.RecordQuery(col)
+	if where != nil {
+		q.AndWhere(where)
+	}
+
+	offset := f.Offset
+	if f.Page > 0 {
+		offset = (f.Page - 1) * limit
+	}
+
+	keysetColumn := ""
+	if f.CursorMode {
+		// keyset pagination works on a single column sort only
+		column, ok := keysetSorts[sort]
+		if !ok || len(sorts) != 1 {
+			return ItemsResponse{}, ErrInvalidCursor
+		}
+		desc := sorts[0].Desc
+		if f.Cursor != "" {
+			c, err := decodeCursor(f.Cursor)
+			if err != nil {
+				return ItemsResponse{}, err
+			}
+			q.AndWhere(keysetExpr(c, column, desc))
+		}
+		direction := sortDirection(desc)
+		q.AndOrderBy("[[items." + column + "]]" + direction).AndOrderBy("[[items.id]]" + direction)
+		keysetColumn = column
+		offset = 0
+	} else if f.FavoritesOf != "" && f.Sort == "" {
+		q.InnerJoin("favorite_items", dbx.NewExp(
+			"[[favorite_items.item]] = [[items.id]] AND [[favorite_items.user]] = {:favorites_of}",
+			dbx.Params{"favorites_of": f.FavoritesOf},
+		))
+		q.AndOrderBy("[[favorite_items.created]] DESC").AndOrderBy("[[items.id]] ASC")
+	} else if err := orderItems(q, sorts, f, searchQuery); err != nil {
+		return ItemsResponse{}, err
+	}
+	resolver.UpdateQuery(q)
+
+	if offset > 0 {
+		q.Offset(int64(offset))
+	}
+	// one extra row tells whether there is a next page
+	q.Limit(int64(limit + 1))
+
+	records := []*core.Record{}
+	if err := q.All(&records); err != nil {
+		return ItemsResponse{}, err
+	}
+
+	hasMore := len(records) > limit
+	if hasMore {
+		records = records[:limit]
+	}
+
+	_ = app.ExpandRecords(records, []string{"category"}, nil)
+
+	covers, err := itemCovers(app, records)
+	if err != nil {
+		return ItemsResponse{}, err
+	}
 
 	items := make([]map[string]any, len(records))
 	for i, r := range records {
 		items[i] = r.PublicExport()
+		localizeItem(r, items[i], f.Lang)
+		// the listing only needs the cover thumbnail
+		delete(items[i], "photos")
+		items[i]["cover"] = nil
+		if photos := r.GetStringSlice("photos"); len(photos) > 0 {
+			items[i]["cover"] = covers[photos[0]]
+		}
+	}
+	if err := setPublicAuthors(app, f.ViewerID, records, items); err != nil {
+		return ItemsResponse{}, err
+	}
+	if err := setFavorites(app, f.ViewerID, records, items); err != nil {
+		return ItemsResponse{}, err
+	}
+
+	if f.Lat != nil && f.Lng != nil {
+		for i, r := range records {
+			if hasCoordinates(r) {
+				d := haversineKm(*f.Lat, *f.Lng, r.GetFloat("latitude"), r.GetFloat("longitude"))
+				items[i]["distance_km"] = math.Round(d*100) / 100
+			} else {
+				items[i]["distance_km"] = nil
+			}
+		}
 	}
 
-	return ItemsResponse{
-		Items: items,
-		Total: len(items),
-	}, nil
+	if searchQuery != "" {
+		ids := make([]string, len(records))
+		for i, r := range records {
+			ids[i] = r.Id
+		}
+		snippets, err := searchSnippets(app, searchQuery, ids)
+		if err != nil {
+			return ItemsResponse{}, err
+		}
+		for i, r := range records {
+			items[i]["snippet"] = snippets[r.Id]
+		}
+	}
+
+	resp := ItemsResponse{
+		Items:      items,
+		Total:      total,
+		PerPage:    limit,
+		TotalPages: (total + limit - 1) / limit,
+		HasMore:    hasMore,
+		Facets:     facets,
+	}
+	if keysetColumn != "" {
+		if hasMore {
+			resp.NextCursor = encodeCursor(records[len(records)-1], keysetColumn)
+		}
+	} else {
+		resp.Page = offset/limit + 1
+	}
+
+	return resp, nil
 }
 
-func GetItem(app core.App, id string) (map[string]any, error) {
-	records, err := app.FindRecordsByFilter("items", "id = {:id}", "", 1, 0, dbx.Params{"id": id})
+func GetItem(app core.App, id, viewerID, lang string) (map[string]any, error) {
+	item, err := app.FindRecordById("items", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrItemNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	_ = app.ExpandRecords(records, []string{"category", "author", "photos"}, nil)
-	return records[0].PublicExport(), nil
+	return exportItem(app, item, viewerID, lang)
 }
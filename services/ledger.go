@@ -0,0 +1,414 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"uley_be/payments"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Ledger accounts. Debits increase cash and deposit_holds, credits increase
+// the rest.
+const (
+	// AccountCash is the money collected at the payment provider.
+	AccountCash = "cash"
+	// AccountCommission is the platform revenue.
+	AccountCommission = "commission"
+	// AccountOwnerPayable is what the platform owes an owner, per owner.
+	AccountOwnerPayable = "owner_payable"
+	// AccountDepositHolds are the deposits held on the renters' cards.
+	AccountDepositHolds = "deposit_holds"
+	// AccountRenterDeposits is the obligation to return the held deposits.
+	AccountRenterDeposits = "renter_deposits"
+)
+
+// Kinds of ledger entries.
+const (
+	EntryCharge          = "charge"
+	EntryRefund          = "refund"
+	EntryDepositHeld     = "deposit_held"
+	EntryDepositReleased = "deposit_released"
+	EntryDamage          = "damage"
+)
+
+// CommissionRate is the platform share of every rent charge.
+const CommissionRate = 0.10
+
+const recentLedgerLines = 20
+
+var ErrUnbalancedEntry = errors.New("ledger entry doesn't balance")
+
+type LedgerLine struct {
+	Account string  `json:"account"`
+	Owner   string  `json:"owner,omitempty"`
+	Debit   float64 `json:"debit"`
+	Credit  float64 `json:"credit"`
+}
+
+// ledgerEntry is an entry to post, Reference makes posting idempotent.
+type ledgerEntry struct {
+	Rent      string
+	Kind      string
+	Reference string
+	Memo      string
+	Lines     []LedgerLine
+}
+
+// cents compares money without float noise.
+func cents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+func (e ledgerEntry) balanced() bool {
+	var debit, credit int64
+	for _, l := range e.Lines {
+		debit += cents(l.Debit)
+		credit += cents(l.Credit)
+	}
+	return len(e.Lines) >= 2 && debit == credit
+}
+
+// commission is the platform share of amount.
+func commission(amount float64) float64 {
+	return roundMoney(amount * CommissionRate)
+}
+
+// rentLedgerEntries returns every entry the rent's payments call for.
+func rentLedgerEntries(app core.App, rent *core.Record) ([]ledgerEntry, error) {
+	item, err := app.FindRecordById("items", rent.GetString("item"))
+	if err != nil {
+		return nil, err
+	}
+	owner := item.GetString("author")
+	entries := []ledgerEntry{}
+
+	charge, err := latestPayment(app, rent.Id, PaymentCharge)
+	if err != nil {
+		return nil, err
+	}
+	// an authorized charge moves no money, voiding it neither
+	if charge != nil && charge.GetString("status") == payments.StatusCaptured {
+		amount := charge.GetFloat("amount")
+		fee := commission(amount)
+		entries = append(entries, ledgerEntry{
+			Rent:      rent.Id,
+			Kind:      EntryCharge,
+			Reference: EntryCharge + ":" + charge.Id,
+			Memo:      "renter charge",
+			Lines: []LedgerLine{
+				{Account: AccountCash, Debit: amount},
+				{Account: AccountCommission, Credit: fee},
+				{Account: AccountOwnerPayable, Owner: owner, Credit: roundMoney(amount - fee)},
+			},
+		})
+
+		refunds, err := app.FindRecordsByFilter(
+			"payments",
+			"parent = {:charge} && kind = {:kind} && status = {:status}",
+			"created", 0, 0,
+			dbx.Params{"charge": charge.Id, "kind": PaymentRefund, "status": payments.StatusSucceeded},
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, refund := range refunds {
+			// the commission is returned in proportion
+			refunded := refund.GetFloat("amount")
+			refundedFee := 0.0
+			if amount > 0 {
+				refundedFee = roundMoney(refunded * fee / amount)
+			}
+			entries = append(entries, ledgerEntry{
+				Rent:      rent.Id,
+				Kind:      EntryRefund,
+				Reference: EntryRefund + ":" + refund.Id,
+				Memo:      "refund to the renter",
+				Lines: []LedgerLine{
+					{Account: AccountOwnerPayable, Owner: owner, Debit: roundMoney(refunded - refundedFee)},
+					{Account: AccountCommission, Debit: refundedFee},
+					{Account: AccountCash, Credit: refunded},
+				},
+			})
+		}
+	}
+
+	deposit, err := latestPayment(app, rent.Id, PaymentDeposit)
+	if err != nil {
+		return nil, err
+	}
+	if deposit != nil {
+		amount := deposit.GetFloat("amount")
+		switch deposit.GetString("status") {
+		case payments.StatusHeld, payments.StatusReleased:
+			entries = append(entries, ledgerEntry{
+				Rent:      rent.Id,
+				Kind:      EntryDepositHeld,
+				Reference: EntryDepositHeld + ":" + deposit.Id,
+				Memo:      "deposit held",
+				Lines: []LedgerLine{
+					{Account: AccountDepositHolds, Debit: amount},
+					{Account: AccountRenterDeposits, Credit: amount},
+				},
+			})
+		}
+		if deposit.GetString("status") == payments.StatusReleased {
+			// the damage the renter paid was captured from the hold
+			claim, err := chargedDamageClaim(app, rent.Id)
+			if err != nil {
+				return nil, err
+			}
+			if claim != nil {
+				damage := math.Min(claim.GetFloat("charged_amount"), amount)
+				amount = roundMoney(amount - damage)
+				entries = append(entries, ledgerEntry{
+					Rent:      rent.Id,
+					Kind:      EntryDamage,
+					Reference: EntryDamage + ":" + claim.Id,
+					Memo:      "damage paid from the deposit",
+					Lines: []LedgerLine{
+						{Account: AccountRenterDeposits, Debit: damage},
+						{Account: AccountDepositHolds, Credit: damage},
+						{Account: AccountCash, Debit: damage},
+						{Account: AccountOwnerPayable, Owner: owner, Credit: damage},
+					},
+				})
+			}
+			if amount > 0 {
+				entries = append(entries, ledgerEntry{
+					Rent:      rent.Id,
+					Kind:      EntryDepositReleased,
+					Reference: EntryDepositReleased + ":" + deposit.Id,
+					Memo:      "deposit released",
+					Lines: []LedgerLine{
+						{Account: AccountRenterDeposits, Debit: amount},
+						{Account: AccountDepositHolds, Credit: amount},
+					},
+				})
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+func ledgerEntryExists(app core.App, reference string) (bool, error) {
+	n, err := app.CountRecords("ledger_entries", dbx.HashExp{"reference": reference})
+	return n > 0, err
+}
+
+// postLedgerEntry writes the entry with its lines in one transaction,
+// entries that were posted before are skipped.
+func postLedgerEntry(app core.App, entry ledgerEntry) error {
+	if !entry.balanced() {
+		return fmt.Errorf("%w: %s", ErrUnbalancedEntry, entry.Reference)
+	}
+
+	return app.RunInTransaction(func(txApp core.App) error {
+		if exists, err := ledgerEntryExists(txApp, entry.Reference); err != nil || exists {
+			return err
+		}
+
+		entriesCol, err := txApp.FindCollectionByNameOrId("ledger_entries")
+		if err != nil {
+			return err
+		}
+		linesCol, err := txApp.FindCollectionByNameOrId("ledger_lines")
+		if err != nil {
+			return err
+		}
+
+		record := core.NewRecord(entriesCol)
+		record.Set("rent", entry.Rent)
+		record.Set("kind", entry.Kind)
+		record.Set("reference", entry.Reference)
+		record.Set("memo", entry.Memo)
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+
+		for _, l := range entry.Lines {
+			line := core.NewRecord(linesCol)
+			line.Set("entry", record.Id)
+			line.Set("account", l.Account)
+			line.Set("owner", l.Owner)
+			line.Set("debit", l.Debit)
+			line.Set("credit", l.Credit)
+			if err := txApp.Save(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PostRentLedger writes the entries the rent's payments call for and that
+// are not in the ledger yet. It runs in the transaction that changes the
+// rent, so the ledger never lags behind it.
+func PostRentLedger(app core.App, rent *core.Record) error {
+	entries, err := rentLedgerEntries(app, rent)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := postLedgerEntry(app, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type BalanceLine struct {
+	Entry   string  `db:"entry" json:"entry"`
+	Kind    string  `db:"kind" json:"kind"`
+	Rent    string  `db:"rent" json:"rent"`
+	Memo    string  `db:"memo" json:"memo"`
+	Debit   float64 `db:"debit" json:"debit"`
+	Credit  float64 `db:"credit" json:"credit"`
+	Created string  `db:"created" json:"created"`
+}
+
+type OwnerBalance struct {
+	Owner    string        `json:"owner"`
+	Currency string        `json:"currency"`
+	Balance  float64       `json:"balance"`
+	Credited float64       `json:"credited"`
+	Debited  float64       `json:"debited"`
+	Recent   []BalanceLine `json:"recent"`
+}
+
+// GetOwnerBalance returns what the platform owes the owner, with the
+// latest movements of their payable account.
+func GetOwnerBalance(app core.App, ownerID string) (OwnerBalance, error) {
+	totals := struct {
+		Credit float64 `db:"credit"`
+		Debit  float64 `db:"debit"`
+	}{}
+	where := dbx.HashExp{"ledger_lines.account": AccountOwnerPayable, "ledger_lines.owner": ownerID}
+	err := app.DB().
+		Select("COALESCE(SUM([[credit]]), 0) AS credit", "COALESCE(SUM([[debit]]), 0) AS debit").
+		From("ledger_lines").
+		Where(where).
+		One(&totals)
+	if err != nil {
+		return OwnerBalance{}, err
+	}
+
+	recent := []BalanceLine{}
+	err = app.DB().
+		Select("ledger_entries.id AS entry", "ledger_entries.kind AS kind", "ledger_entries.rent AS rent",
+			"ledger_entries.memo AS memo", "ledger_lines.debit AS debit", "ledger_lines.credit AS credit",
+			"ledger_lines.created AS created").
+		From("ledger_lines").
+		InnerJoin("ledger_entries", dbx.NewExp("[[ledger_entries.id]] = [[ledger_lines.entry]]")).
+		Where(where).
+		OrderBy("ledger_lines.created DESC", "ledger_lines.id DESC").
+		Limit(recentLedgerLines).
+		All(&recent)
+	if err != nil {
+		return OwnerBalance{}, err
+	}
+
+	return OwnerBalance{
+		Owner:    ownerID,
+		Currency: Currency,
+		Balance:  roundMoney(totals.Credit - totals.Debit),
+		Credited: roundMoney(totals.Credit),
+		Debited:  roundMoney(totals.Debit),
+		Recent:   recent,
+	}, nil
+}
+
+// LedgerReport is the result of ReconcileLedger. Accounts hold debits
+// minus credits.
+type LedgerReport struct {
+	Entries    int
+	Accounts   map[string]float64
+	Unbalanced []string
+	Missing    []string
+	Posted     int
+}
+
+func (r LedgerReport) OK() bool {
+	return len(r.Unbalanced) == 0 && r.Posted == len(r.Missing)
+}
+
+// ReconcileLedger checks that every entry balances and that every rent
+// has the entries its payments call for; with fix the missing ones are
+// posted.
+func ReconcileLedger(app core.App, fix bool) (LedgerReport, error) {
+	report := LedgerReport{Accounts: map[string]float64{}}
+
+	// missing entries first, so the totals include the fixed ones
+	rents, err := app.FindAllRecords("rents")
+	if err != nil {
+		return report, err
+	}
+	missing := []ledgerEntry{}
+	for _, rent := range rents {
+		entries, err := rentLedgerEntries(app, rent)
+		if err != nil {
+			return report, err
+		}
+		for _, entry := range entries {
+			exists, err := ledgerEntryExists(app, entry.Reference)
+			if err != nil {
+				return report, err
+			}
+			if !exists {
+				missing = append(missing, entry)
+			}
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Reference < missing[j].Reference })
+
+	for _, entry := range missing {
+		report.Missing = append(report.Missing, entry.Reference)
+	}
+	if fix {
+		for _, entry := range missing {
+			if err := postLedgerEntry(app, entry); err != nil {
+				return report, err
+			}
+			report.Posted++
+		}
+	}
+
+	total, err := app.CountRecords("ledger_entries")
+	if err != nil {
+		return report, err
+	}
+	report.Entries = int(total)
+
+	err = app.DB().
+		Select("entry").
+		From("ledger_lines").
+		GroupBy("entry").
+		Having(dbx.NewExp("SUM(ROUND([[debit]] * 100)) != SUM(ROUND([[credit]] * 100))")).
+		Column(&report.Unbalanced)
+	if err != nil {
+		return report, err
+	}
+
+	accounts := []struct {
+		Account string  `db:"account"`
+		Balance float64 `db:"balance"`
+	}{}
+	err = app.DB().
+		Select("account", "SUM([[debit]]) - SUM([[credit]]) AS balance").
+		From("ledger_lines").
+		GroupBy("account").
+		All(&accounts)
+	if err != nil {
+		return report, err
+	}
+	for _, a := range accounts {
+		report.Accounts[a.Account] = roundMoney(a.Balance)
+	}
+
+	return report, nil
+}
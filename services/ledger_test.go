@@ -0,0 +1,71 @@
+package services
+
+import "testing"
+
+func TestLedgerEntryBalanced(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		lines    []LedgerLine
+		expected bool
+	}{
+		{"no lines", nil, false},
+		{"single line", []LedgerLine{{Account: AccountCash, Debit: 100}}, false},
+		{
+			"charge with commission",
+			[]LedgerLine{
+				{Account: AccountCash, Debit: 1000},
+				{Account: AccountCommission, Credit: 100},
+				{Account: AccountOwnerPayable, Owner: "owner", Credit: 900},
+			},
+			true,
+		},
+		{
+			"off by a cent",
+			[]LedgerLine{
+				{Account: AccountCash, Debit: 1000},
+				{Account: AccountOwnerPayable, Owner: "owner", Credit: 999.99},
+			},
+			false,
+		},
+		{
+			"float noise",
+			[]LedgerLine{
+				{Account: AccountCash, Debit: 0.3},
+				{Account: AccountCommission, Credit: 0.1},
+				{Account: AccountOwnerPayable, Owner: "owner", Credit: 0.2},
+			},
+			true,
+		},
+		{
+			"zero amounts",
+			[]LedgerLine{{Account: AccountCash}, {Account: AccountCommission}},
+			true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if got := (ledgerEntry{Lines: s.lines}).balanced(); got != s.expected {
+				t.Fatalf("Expected %v, got %v", s.expected, got)
+			}
+		})
+	}
+}
+
+func TestCommission(t *testing.T) {
+	scenarios := []struct {
+		amount   float64
+		expected float64
+	}{
+		{0, 0},
+		{1000, 100},
+		{1234.56, 123.46},
+		{0.04, 0},
+	}
+
+	for _, s := range scenarios {
+		if got := commission(s.amount); got != s.expected {
+			t.Errorf("commission(%v): expected %v, got %v", s.amount, s.expected, got)
+		}
+	}
+}
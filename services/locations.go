@@ -0,0 +1,81 @@
+package services
+
+import (
+	"uley_be/gazetteer"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const defaultLocationsLimit = 10
+
+type LocationSuggestion struct {
+	ID     string  `json:"id"`
+	Type   string  `json:"type"`
+	Parent string  `json:"parent,omitempty"`
+	Label  string  `json:"label"`
+	NameRu string  `json:"name_ru"`
+	NameKk string  `json:"name_kk"`
+	NameEn string  `json:"name_en"`
+	Lat    float64 `json:"lat"`
+	Lng    float64 `json:"lng"`
+}
+
+func SuggestLocations(q string, limit int) []LocationSuggestion {
+	if limit <= 0 {
+		limit = defaultLocationsLimit
+	}
+
+	found := gazetteer.Search(q, limit)
+	result := make([]LocationSuggestion, len(found))
+	for i, loc := range found {
+		result[i] = LocationSuggestion{
+			ID:     loc.ID,
+			Type:   loc.Type,
+			Parent: loc.Parent,
+			Label:  loc.Label(),
+			NameRu: loc.NameRu,
+			NameKk: loc.NameKk,
+			NameEn: loc.NameEn,
+			Lat:    loc.Lat,
+			Lng:    loc.Lng,
+		}
+	}
+	return result
+}
+
+// NormalizeItemLocation sets location_id from the free-text location and
+// fills in the coordinates from the gazetteer when the owner didn't set them.
+// When the location moves to another place the coordinates follow it, unless
+// the same update sets them.
+func NormalizeItemLocation(item *core.Record) {
+	original := item.Original()
+	coordinatesSet := item.GetFloat("latitude") != original.GetFloat("latitude") ||
+		item.GetFloat("longitude") != original.GetFloat("longitude")
+
+	loc, ok := gazetteer.Resolve(item.GetString("location"))
+	if !ok {
+		// the coordinates of the old place would be wrong for the new one
+		if original.GetString("location_id") != "" && !coordinatesSet {
+			item.Set("latitude", 0)
+			item.Set("longitude", 0)
+		}
+		item.Set("location_id", "")
+		return
+	}
+
+	moved := loc.ID != original.GetString("location_id") && !coordinatesSet
+	item.Set("location_id", loc.ID)
+	if moved || !hasCoordinates(item) {
+		item.Set("latitude", loc.Lat)
+		item.Set("longitude", loc.Lng)
+	}
+}
+
+// locationIDExpr matches the location and, for a city, all of its districts.
+func locationIDExpr(id string) dbx.Expression {
+	return dbx.Or(
+		dbx.HashExp{"items.location_id": id},
+		dbx.NewExp("[[items.location_id]] LIKE {:location_id_prefix}", dbx.Params{"location_id_prefix": id + ".%"}),
+	)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const defaultItemsLimit = 30
+
+// MaxItemsLimit caps the page size of the items listing.
+const MaxItemsLimit = 100
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// keysetSorts are the sorts supported in cursor mode, mapped to their column.
+var keysetSorts = map[string]string{
+	"created":  "created",
+	"-created": "created",
+	"price":    "price",
+	"-price":   "price",
+}
+
+type itemsCursor struct {
+	Value any    `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(record *core.Record, column string) string {
+	raw, _ := json.Marshal(itemsCursor{Value: record.Get(column), ID: record.Id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) (itemsCursor, error) {
+	c := itemsCursor{}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" || c.Value == nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// keysetExpr matches the rows that come after the cursor for the given sort.
+func keysetExpr(c itemsCursor, column string, desc bool) dbx.Expression {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	col := "[[items." + column + "]]"
+	return dbx.NewExp(
+		"("+col+" "+op+" {:cursor_value} OR ("+col+" = {:cursor_value} AND [[items.id]] "+op+" {:cursor_id}))",
+		dbx.Params{"cursor_value": c.Value, "cursor_id": c.ID},
+	)
+}
@@ -0,0 +1,570 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sync"
+
+	"uley_be/payments"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Kinds of the payments collection records.
+const (
+	PaymentCharge  = "charge"
+	PaymentDeposit = "deposit"
+	PaymentRefund  = "refund"
+)
+
+// Rent payment_status values.
+const (
+	RentUnpaid            = "unpaid"
+	RentPaymentPending    = "pending"
+	RentAuthorized        = "authorized"
+	RentPaid              = "paid"
+	RentPaymentFailed     = "failed"
+	RentRefunded          = "refunded"
+	RentPartiallyRefunded = "partially_refunded"
+)
+
+// Rent deposit_status values, the rest are the payment statuses.
+const DepositNone = "none"
+
+const paymentProviderKey = "paymentProvider"
+
+var (
+	ErrNoPaymentProvider = errors.New("payments are disabled, no payment provider is configured")
+	ErrUnknownProvider   = errors.New("unknown payment provider")
+	ErrRentNotPayable    = errors.New("rent can't be paid in its current status")
+	ErrRentAlreadyPaid   = errors.New("rent is already paid")
+	ErrPaymentNotFound   = errors.New("payment not found")
+	ErrNotFakeProvider   = errors.New("the fake checkout needs the fake payment provider")
+)
+
+// payLocks serialize PayRent per rent (striped by the rent id), a double
+// submit must not create two charges. The app is a single process on SQLite,
+// so a lock in memory is enough.
+var payLocks [64]sync.Mutex
+
+func lockRentPayment(rentID string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(rentID))
+	mu := &payLocks[h.Sum32()%uint32(len(payLocks))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// paymentStatusRank orders the payment statuses, webhooks never move a
+// payment back (a late "authorized" after "captured" is ignored).
+var paymentStatusRank = map[string]int{
+	payments.StatusPending:    0,
+	payments.StatusAuthorized: 1,
+	payments.StatusHeld:       1,
+	payments.StatusCaptured:   2,
+	payments.StatusSucceeded:  2,
+	payments.StatusFailed:     2,
+	payments.StatusReleased:   3,
+}
+
+// eventStatuses maps webhook events to the payment status they set.
+var eventStatuses = map[string]string{
+	payments.EventAuthorized:      payments.StatusAuthorized,
+	payments.EventCaptured:        payments.StatusCaptured,
+	payments.EventFailed:          payments.StatusFailed,
+	payments.EventRefunded:        payments.StatusSucceeded,
+	payments.EventDepositHeld:     payments.StatusHeld,
+	payments.EventDepositReleased: payments.StatusReleased,
+}
+
+// SetPaymentProvider makes p the provider of the app.
+func SetPaymentProvider(app core.App, p payments.PaymentProvider) {
+	app.Store().Set(paymentProviderKey, p)
+}
+
+func paymentProvider(app core.App) (payments.PaymentProvider, error) {
+	p, ok := app.Store().Get(paymentProviderKey).(payments.PaymentProvider)
+	if !ok {
+		return nil, ErrNoPaymentProvider
+	}
+	return p, nil
+}
+
+// FakePayments reports whether the app runs on the fake provider.
+func FakePayments(app core.App) bool {
+	p, err := paymentProvider(app)
+	return err == nil && p.Name() == payments.FakeName
+}
+
+// latestPayment returns the newest payment of the kind for the rent, nil
+// if there is none.
+func latestPayment(app core.App, rentID, kind string) (*core.Record, error) {
+	records, err := app.FindRecordsByFilter(
+		"payments",
+		"rent = {:rent} && kind = {:kind}",
+		"-created,-id", 1, 0,
+		dbx.Params{"rent": rentID, "kind": kind},
+	)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+func savePayment(app core.App, rent *core.Record, kind, providerName string, intent payments.Intent, parentID string) (*core.Record, error) {
+	col, err := app.FindCollectionByNameOrId("payments")
+	if err != nil {
+		return nil, err
+	}
+	payment := core.NewRecord(col)
+	payment.Set("rent", rent.Id)
+	payment.Set("kind", kind)
+	payment.Set("status", intent.Status)
+	payment.Set("provider", providerName)
+	payment.Set("provider_id", intent.ID)
+	payment.Set("amount", intent.Amount)
+	payment.Set("currency", Currency)
+	payment.Set("checkout_url", intent.CheckoutURL)
+	payment.Set("parent", parentID)
+	return payment, app.Save(payment)
+}
+
+// syncRentPayment derives payment_status and deposit_status of the rent
+// from its payments.
+func syncRentPayment(app core.App, rent *core.Record) error {
+	status := RentUnpaid
+	charge, err := latestPayment(app, rent.Id, PaymentCharge)
+	if err != nil {
+		return err
+	}
+	if charge != nil {
+		switch charge.GetString("status") {
+		case payments.StatusPending:
+			status = RentPaymentPending
+		case payments.StatusAuthorized:
+			status = RentAuthorized
+		case payments.StatusCaptured:
+			status = RentPaid
+		case payments.StatusFailed:
+			status = RentPaymentFailed
+		}
+
+		refunded, err := refundedAmount(app, charge.Id)
+		if err != nil {
+			return err
+		}
+		switch {
+		case refunded > 0 && refunded >= charge.GetFloat("amount"):
+			status = RentRefunded
+		case refunded > 0:
+			status = RentPartiallyRefunded
+		}
+	}
+
+	depositStatus := DepositNone
+	deposit, err := latestPayment(app, rent.Id, PaymentDeposit)
+	if err != nil {
+		return err
+	}
+	if deposit != nil {
+		depositStatus = deposit.GetString("status")
+	}
+
+	rent.Set("payment_status", status)
+	rent.Set("deposit_status", depositStatus)
+	return app.Save(rent)
+}
+
+// refundedAmount sums the succeeded refunds of the charge.
+func refundedAmount(app core.App, chargeID string) (float64, error) {
+	refunded := 0.0
+	err := app.DB().Select("COALESCE(SUM([[amount]]), 0)").
+		From("payments").
+		Where(dbx.HashExp{"parent": chargeID, "kind": PaymentRefund, "status": payments.StatusSucceeded}).
+		Row(&refunded)
+	return refunded, err
+}
+
+func exportPayments(records []*core.Record) []map[string]any {
+	result := make([]map[string]any, len(records))
+	for i, r := range records {
+		result[i] = r.PublicExport()
+	}
+	return result
+}
+
+// PayRent starts the payment of an approved rent: the charge of the rent
+// amount and the deposit hold. The payer follows checkout_url of the
+// pending payments. Paying again while they are pending returns them, a
+// retry after a failed charge keeps the deposit hold that is still live.
+func PayRent(app core.App, rentID, renterID string) ([]map[string]any, error) {
+	provider, err := paymentProvider(app)
+	if err != nil {
+		return nil, err
+	}
+	unlock := lockRentPayment(rentID)
+	defer unlock()
+
+	rent, err := app.FindRecordById("rents", rentID)
+	if err != nil {
+		return nil, ErrRentNotFound
+	}
+	if rent.GetString("renter") != renterID {
+		return nil, ErrNotRentParty
+	}
+	if rentStatusName(app, rent) != StatusApproved {
+		return nil, ErrRentNotPayable
+	}
+
+	charge, err := latestPayment(app, rent.Id, PaymentCharge)
+	if err != nil {
+		return nil, err
+	}
+	if charge != nil {
+		switch charge.GetString("status") {
+		case payments.StatusPending:
+			pending, err := app.FindRecordsByFilter("payments", "rent = {:rent} && status = {:status}", "created", 0, 0,
+				dbx.Params{"rent": rent.Id, "status": payments.StatusPending})
+			if err != nil {
+				return nil, err
+			}
+			return exportPayments(pending), nil
+		case payments.StatusAuthorized, payments.StatusCaptured:
+			return nil, ErrRentAlreadyPaid
+		}
+	}
+
+	ctx := context.Background()
+	req := payments.IntentRequest{
+		Reference:   rent.Id,
+		Amount:      rent.GetFloat("amount"),
+		Currency:    Currency,
+		Description: "rent " + rent.Id,
+	}
+	intent, err := provider.CreateIntent(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	deposit, err := latestPayment(app, rent.Id, PaymentDeposit)
+	if err != nil {
+		return nil, err
+	}
+	liveHold := false
+	if deposit != nil {
+		switch deposit.GetString("status") {
+		case payments.StatusPending, payments.StatusHeld:
+			liveHold = true
+		}
+	}
+
+	var hold *payments.Intent
+	if amount := rent.GetFloat("deposit"); amount > 0 && !liveHold {
+		req.Amount = amount
+		req.Description = "deposit for rent " + rent.Id
+		h, err := provider.HoldDeposit(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		hold = &h
+	}
+
+	created := []*core.Record{}
+	err = app.RunInTransaction(func(txApp core.App) error {
+		payment, err := savePayment(txApp, rent, PaymentCharge, provider.Name(), intent, "")
+		if err != nil {
+			return err
+		}
+		created = append(created, payment)
+		if hold != nil {
+			payment, err := savePayment(txApp, rent, PaymentDeposit, provider.Name(), *hold, "")
+			if err != nil {
+				return err
+			}
+			created = append(created, payment)
+		} else if liveHold && deposit.GetString("status") == payments.StatusPending {
+			// the payer still has to confirm it
+			created = append(created, deposit)
+		}
+		return syncRentPayment(txApp, rent)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return exportPayments(created), nil
+}
+
+// RentPayments lists the payments and refunds of the rent for its parties.
+func RentPayments(app core.App, rentID, userID string) ([]map[string]any, error) {
+	rent, err := app.FindRecordById("rents", rentID)
+	if err != nil {
+		return nil, ErrRentNotFound
+	}
+	if _, err := rentParty(app, rent, userID); err != nil {
+		return nil, err
+	}
+
+	records, err := app.FindRecordsByFilter("payments", "rent = {:rent}", "created", 0, 0, dbx.Params{"rent": rent.Id})
+	if err != nil {
+		return nil, err
+	}
+	return exportPayments(records), nil
+}
+
+// setPaymentStatus moves the payment forward to status and resyncs the
+// rent. Moves back are ignored.
+func setPaymentStatus(app core.App, payment *core.Record, status string) error {
+	if paymentStatusRank[status] <= paymentStatusRank[payment.GetString("status")] {
+		return nil
+	}
+	return app.RunInTransaction(func(txApp core.App) error {
+		payment.Set("status", status)
+		if err := txApp.Save(payment); err != nil {
+			return err
+		}
+		rent, err := txApp.FindRecordById("rents", payment.GetString("rent"))
+		if err != nil {
+			return err
+		}
+		return syncRentPayment(txApp, rent)
+	})
+}
+
+// HandlePaymentWebhook verifies and applies a webhook of the named
+// provider. Events about unknown payments are ignored.
+func HandlePaymentWebhook(app core.App, providerName string, payload []byte, header http.Header) error {
+	provider, err := paymentProvider(app)
+	if err != nil {
+		return err
+	}
+	if provider.Name() != providerName {
+		return ErrUnknownProvider
+	}
+
+	event, err := provider.ParseWebhook(payload, header)
+	if err != nil {
+		return err
+	}
+	status, ok := eventStatuses[event.Type]
+	if !ok {
+		return nil
+	}
+
+	payment, err := app.FindFirstRecordByFilter(
+		"payments",
+		"provider = {:provider} && provider_id = {:id}",
+		dbx.Params{"provider": provider.Name(), "id": event.ObjectID},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		// the provider retries a webhook that wasn't acknowledged
+		return err
+	}
+	if err := setPaymentStatus(app, payment, status); err != nil {
+		return err
+	}
+	return voidLatePayment(app, payment)
+}
+
+// voidLatePayment gives back an authorization or hold that arrived after
+// the rent was called off, the settlement of the rent has passed it by.
+func voidLatePayment(app core.App, payment *core.Record) error {
+	rent, err := app.FindRecordById("rents", payment.GetString("rent"))
+	if err != nil {
+		return err
+	}
+	switch rentStatusName(app, rent) {
+	case StatusCancelled, StatusDeclined:
+	default:
+		return nil
+	}
+
+	switch {
+	case payment.GetString("kind") == PaymentCharge && payment.GetString("status") == payments.StatusAuthorized:
+		// a repeated webhook finds it voided already
+		refunded, err := refundedAmount(app, payment.Id)
+		if err != nil {
+			return err
+		}
+		return refundCharge(app, rent, payment, roundMoney(payment.GetFloat("amount")-refunded))
+	case payment.GetString("kind") == PaymentDeposit && payment.GetString("status") == payments.StatusHeld:
+		return releaseDeposit(app, payment)
+	}
+	return nil
+}
+
+// ConfirmFakePayment plays the payer on the fake checkout page: it sends
+// the signed webhook the fake provider would send for the payment.
+func ConfirmFakePayment(app core.App, providerID, userID string, fail bool) error {
+	provider, err := paymentProvider(app)
+	if err != nil {
+		return err
+	}
+	fake, ok := provider.(*payments.FakeProvider)
+	if !ok {
+		return ErrNotFakeProvider
+	}
+
+	payment, err := app.FindFirstRecordByFilter(
+		"payments",
+		"provider = {:provider} && provider_id = {:id}",
+		dbx.Params{"provider": fake.Name(), "id": providerID},
+	)
+	if err != nil {
+		return ErrPaymentNotFound
+	}
+	rent, err := app.FindRecordById("rents", payment.GetString("rent"))
+	if err != nil || rent.GetString("renter") != userID {
+		return ErrNotRentParty
+	}
+
+	event := payments.EventAuthorized
+	if payment.GetString("kind") == PaymentDeposit {
+		event = payments.EventDepositHeld
+	}
+	if fail {
+		event = payments.EventFailed
+	}
+	payload, header := fake.Webhook(event, providerID, payment.GetFloat("amount"))
+	return HandlePaymentWebhook(app, fake.Name(), payload, header)
+}
+
+// captureRentCharge takes the authorized rent charge.
+func captureRentCharge(app core.App, rent *core.Record) error {
+	charge, err := latestPayment(app, rent.Id, PaymentCharge)
+	if err != nil || charge == nil || charge.GetString("status") != payments.StatusAuthorized {
+		return err
+	}
+	provider, err := paymentProvider(app)
+	if err != nil {
+		return err
+	}
+
+	intent, err := provider.Capture(context.Background(), charge.GetString("provider_id"), charge.GetFloat("amount"))
+	if err != nil {
+		return err
+	}
+	return setPaymentStatus(app, charge, intent.Status)
+}
+
+// refundRentCharge returns amount of the rent charge, a charge that was
+// only authorized is voided.
+func refundRentCharge(app core.App, rent *core.Record, amount float64) error {
+	if amount <= 0 {
+		return nil
+	}
+	charge, err := latestPayment(app, rent.Id, PaymentCharge)
+	if err != nil || charge == nil {
+		return err
+	}
+	return refundCharge(app, rent, charge, amount)
+}
+
+// refundCharge returns amount of the charge, or voids it when it was only
+// authorized.
+func refundCharge(app core.App, rent, charge *core.Record, amount float64) error {
+	if amount <= 0 {
+		return nil
+	}
+	switch charge.GetString("status") {
+	case payments.StatusAuthorized, payments.StatusCaptured:
+	default:
+		return nil
+	}
+	provider, err := paymentProvider(app)
+	if err != nil {
+		return err
+	}
+
+	refund, err := provider.Refund(context.Background(), charge.GetString("provider_id"), amount)
+	if err != nil {
+		return err
+	}
+	return app.RunInTransaction(func(txApp core.App) error {
+		intent := payments.Intent{ID: refund.ID, Status: refund.Status, Amount: refund.Amount}
+		if _, err := savePayment(txApp, rent, PaymentRefund, provider.Name(), intent, charge.Id); err != nil {
+			return err
+		}
+		return syncRentPayment(txApp, rent)
+	})
+}
+
+// releaseRentDeposit frees the deposit hold of the rent.
+func releaseRentDeposit(app core.App, rent *core.Record) error {
+	deposit, err := latestPayment(app, rent.Id, PaymentDeposit)
+	if err != nil || deposit == nil {
+		return err
+	}
+	return releaseDeposit(app, deposit)
+}
+
+// releaseDeposit frees a pending or held deposit payment.
+func releaseDeposit(app core.App, deposit *core.Record) error {
+	switch deposit.GetString("status") {
+	case payments.StatusPending, payments.StatusHeld:
+	default:
+		return nil
+	}
+	provider, err := paymentProvider(app)
+	if err != nil {
+		return err
+	}
+
+	hold, err := provider.ReleaseDeposit(context.Background(), deposit.GetString("provider_id"))
+	if err != nil {
+		return err
+	}
+	return setPaymentStatus(app, deposit, hold.Status)
+}
+
+// refundCancelledRent refunds what the cancellation breakdown of the rent
+// says. The retained part of an authorized charge is captured first.
+func refundCancelledRent(app core.App, rent *core.Record) error {
+	breakdown := CancellationBreakdown{}
+	if err := rent.UnmarshalJSONField("cancellation", &breakdown); err != nil || breakdown.Policy == "" {
+		return refundRentCharge(app, rent, rent.GetFloat("amount"))
+	}
+
+	charge, err := latestPayment(app, rent.Id, PaymentCharge)
+	if err != nil || charge == nil {
+		return err
+	}
+	refund := math.Min(breakdown.Refund, charge.GetFloat("amount"))
+	if refund < charge.GetFloat("amount") {
+		if err := captureRentCharge(app, rent); err != nil {
+			return err
+		}
+	}
+	return refundRentCharge(app, rent, refund)
+}
+
+// settleRentPayments moves the money after a rent status change: the
+// charge is captured on handover, refunded when the rent is called off
+// (by the cancellation policy when cancelled), and the deposit is released
+// when the rent ends.
+func settleRentPayments(app core.App, rent *core.Record, status string) error {
+	switch status {
+	case StatusHandedOver:
+		return captureRentCharge(app, rent)
+	case StatusCancelled:
+		if err := refundCancelledRent(app, rent); err != nil {
+			return err
+		}
+		return releaseRentDeposit(app, rent)
+	case StatusDeclined:
+		if err := refundRentCharge(app, rent, rent.GetFloat("amount")); err != nil {
+			return err
+		}
+		return releaseRentDeposit(app, rent)
+	case StatusClosed:
+		return releaseRentDeposit(app, rent)
+	}
+	return nil
+}
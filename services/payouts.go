@@ -0,0 +1,301 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Statuses of payout batches and of the payouts in them.
+const (
+	PayoutPending  = "pending"
+	PayoutExported = "exported"
+	PayoutPaid     = "paid"
+)
+
+// EntryPayout moves the paid out money from the owner's payable account.
+const EntryPayout = "payout"
+
+// MinPayoutAmount is the smallest sum paid out, smaller earnings wait for
+// the next batch.
+const MinPayoutAmount = 1000.0
+
+// settledRentStatuses are final, the money of these rents won't move again.
+var settledRentStatuses = []string{StatusClosed, StatusCancelled, StatusDeclined}
+
+var (
+	ErrPayoutBatchNotFound    = errors.New("payout batch not found")
+	ErrPayoutBatchPaid        = errors.New("payout batch is already paid")
+	ErrPayoutBatchNotExported = errors.New("payout batch must be exported before it is paid")
+)
+
+type settledLine struct {
+	Id     string  `db:"id"`
+	Owner  string  `db:"owner"`
+	Debit  float64 `db:"debit"`
+	Credit float64 `db:"credit"`
+}
+
+// settledEarnings returns the owner_payable lines of settled rents that
+// aren't in a payout yet.
+func settledEarnings(app core.App) ([]settledLine, error) {
+	statuses := make([]any, len(settledRentStatuses))
+	for i, s := range settledRentStatuses {
+		statuses[i] = s
+	}
+
+	lines := []settledLine{}
+	err := app.DB().
+		Select("ledger_lines.id AS id", "ledger_lines.owner AS owner", "ledger_lines.debit AS debit", "ledger_lines.credit AS credit").
+		From("ledger_lines").
+		InnerJoin("ledger_entries", dbx.NewExp("[[ledger_entries.id]] = [[ledger_lines.entry]]")).
+		InnerJoin("rents", dbx.NewExp("[[rents.id]] = [[ledger_entries.rent]]")).
+		InnerJoin("statuses", dbx.NewExp("[[statuses.id]] = [[rents.status]]")).
+		Where(dbx.HashExp{"ledger_lines.account": AccountOwnerPayable, "ledger_lines.payout": ""}).
+		AndWhere(dbx.NewExp("[[ledger_lines.owner]] != ''")).
+		AndWhere(dbx.In("statuses.name", statuses...)).
+		OrderBy("ledger_lines.owner", "ledger_lines.created").
+		All(&lines)
+	return lines, err
+}
+
+// SchedulePayouts groups the settled earnings per owner into a new pending
+// batch. Owners without a payout IBAN or below MinPayoutAmount are left for
+// a later batch. It returns nil when there is nothing to pay out.
+func SchedulePayouts(app core.App) (*core.Record, error) {
+	var batch *core.Record
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		lines, err := settledEarnings(txApp)
+		if err != nil {
+			return err
+		}
+
+		owners := []string{}
+		byOwner := map[string][]settledLine{}
+		for _, l := range lines {
+			if _, ok := byOwner[l.Owner]; !ok {
+				owners = append(owners, l.Owner)
+			}
+			byOwner[l.Owner] = append(byOwner[l.Owner], l)
+		}
+
+		batchesCol, err := txApp.FindCollectionByNameOrId("payout_batches")
+		if err != nil {
+			return err
+		}
+		payoutsCol, err := txApp.FindCollectionByNameOrId("payouts")
+		if err != nil {
+			return err
+		}
+
+		total, count := 0.0, 0
+		for _, ownerID := range owners {
+			amount := 0.0
+			for _, l := range byOwner[ownerID] {
+				amount += l.Credit - l.Debit
+			}
+			amount = roundMoney(amount)
+			if amount < MinPayoutAmount {
+				continue
+			}
+			owner, err := txApp.FindRecordById("users", ownerID)
+			if err != nil || owner.GetString("payout_iban") == "" {
+				continue
+			}
+
+			if batch == nil {
+				batch = core.NewRecord(batchesCol)
+				batch.Set("status", PayoutPending)
+				if err := txApp.Save(batch); err != nil {
+					return err
+				}
+			}
+
+			payout := core.NewRecord(payoutsCol)
+			payout.Set("batch", batch.Id)
+			payout.Set("owner", ownerID)
+			payout.Set("amount", amount)
+			payout.Set("currency", Currency)
+			payout.Set("iban", owner.GetString("payout_iban"))
+			payout.Set("status", PayoutPending)
+			if err := txApp.Save(payout); err != nil {
+				return err
+			}
+
+			ids := make([]any, len(byOwner[ownerID]))
+			for i, l := range byOwner[ownerID] {
+				ids[i] = l.Id
+			}
+			_, err = txApp.DB().
+				Update("ledger_lines", dbx.Params{"payout": payout.Id}, dbx.In("id", ids...)).
+				Execute()
+			if err != nil {
+				return err
+			}
+
+			total += amount
+			count++
+		}
+
+		if batch == nil {
+			return nil
+		}
+		batch.Set("total", roundMoney(total))
+		batch.Set("payouts_count", count)
+		return txApp.Save(batch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func findPayoutBatch(app core.App, batchID string) (*core.Record, error) {
+	batch, err := app.FindRecordById("payout_batches", batchID)
+	if err != nil {
+		return nil, ErrPayoutBatchNotFound
+	}
+	return batch, nil
+}
+
+func batchPayouts(app core.App, batchID string) ([]*core.Record, error) {
+	return app.FindRecordsByFilter("payouts", "batch = {:batch}", "created", 0, 0, dbx.Params{"batch": batchID})
+}
+
+// setPayoutsStatus moves the batch and its payouts to status.
+func setPayoutsStatus(app core.App, batch *core.Record, status string) error {
+	payouts, err := batchPayouts(app, batch.Id)
+	if err != nil {
+		return err
+	}
+	for _, payout := range payouts {
+		payout.Set("status", status)
+		if err := app.Save(payout); err != nil {
+			return err
+		}
+	}
+	batch.Set("status", status)
+	return app.Save(batch)
+}
+
+// payoutCSVHeader is the bank's bulk transfer format.
+var payoutCSVHeader = []string{"reference", "recipient", "iin", "iban", "amount", "currency", "purpose"}
+
+// csvCell drops the leading characters that make a spreadsheet read a user
+// value as a formula. The file goes to the bank too, so no quote is added.
+func csvCell(value string) string {
+	return strings.TrimLeft(strings.TrimSpace(value), "=+-@ \t\r")
+}
+
+// ExportPayoutBatch writes the batch as a bank transfer CSV and marks a
+// pending batch exported.
+func ExportPayoutBatch(app core.App, batchID string, w io.Writer) error {
+	batch, err := findPayoutBatch(app, batchID)
+	if err != nil {
+		return err
+	}
+	payouts, err := batchPayouts(app, batch.Id)
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(payoutCSVHeader); err != nil {
+		return err
+	}
+	for _, payout := range payouts {
+		recipient, iin := "", ""
+		if owner, err := app.FindRecordById("users", payout.GetString("owner")); err == nil {
+			recipient = csvCell(owner.GetString("first_name") + " " + owner.GetString("last_name"))
+			iin = csvCell(owner.GetString("identity"))
+		}
+		err := out.Write([]string{
+			payout.Id,
+			recipient,
+			iin,
+			payout.GetString("iban"),
+			fmt.Sprintf("%.2f", payout.GetFloat("amount")),
+			payout.GetString("currency"),
+			"Uley payout " + batch.Id,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return err
+	}
+
+	if batch.GetString("status") != PayoutPending {
+		return nil
+	}
+	return app.RunInTransaction(func(txApp core.App) error {
+		batch.Set("exported_at", types.NowDateTime())
+		return setPayoutsStatus(txApp, batch, PayoutExported)
+	})
+}
+
+// MarkPayoutBatchPaid records that the bank made the transfers: the paid
+// out amounts leave the owners' payable accounts.
+func MarkPayoutBatchPaid(app core.App, batchID string) (*core.Record, error) {
+	var batch *core.Record
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		batch, err = findPayoutBatch(txApp, batchID)
+		if err != nil {
+			return err
+		}
+		if batch.GetString("status") == PayoutPaid {
+			return ErrPayoutBatchPaid
+		}
+		// a batch the bank never received can't have been paid out
+		if batch.GetString("status") != PayoutExported {
+			return ErrPayoutBatchNotExported
+		}
+
+		payouts, err := batchPayouts(txApp, batch.Id)
+		if err != nil {
+			return err
+		}
+		for _, payout := range payouts {
+			amount := payout.GetFloat("amount")
+			err := postLedgerEntry(txApp, ledgerEntry{
+				Kind:      EntryPayout,
+				Reference: EntryPayout + ":" + payout.Id,
+				Memo:      "payout to the owner",
+				Lines: []LedgerLine{
+					{Account: AccountOwnerPayable, Owner: payout.GetString("owner"), Debit: amount},
+					{Account: AccountCash, Credit: amount},
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		batch.Set("paid_at", types.NowDateTime())
+		return setPayoutsStatus(txApp, batch, PayoutPaid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func ListPayoutBatches(app core.App) ([]*core.Record, error) {
+	return app.FindRecordsByFilter("payout_batches", "", "-created", 0, 0)
+}
+
+// OwnerPayouts returns the owner's payouts, newest first.
+func OwnerPayouts(app core.App, ownerID string) ([]*core.Record, error) {
+	return app.FindRecordsByFilter("payouts", "owner = {:owner}", "-created", 0, 0, dbx.Params{"owner": ownerID})
+}
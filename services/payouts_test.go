@@ -0,0 +1,26 @@
+package services
+
+import "testing"
+
+func TestCSVCell(t *testing.T) {
+	scenarios := []struct {
+		value    string
+		expected string
+	}{
+		{"", ""},
+		{"Иван Петров", "Иван Петров"},
+		{"=SUM(A1:A9)", "SUM(A1:A9)"},
+		{"+77011234567", "77011234567"},
+		{"-100", "100"},
+		{"@cmd", "cmd"},
+		{" \t=+x", "x"},
+		{"a=b", "a=b"},
+		{"KZ123456789012345678 ", "KZ123456789012345678"},
+	}
+
+	for _, s := range scenarios {
+		if got := csvCell(s.value); got != s.expected {
+			t.Errorf("csvCell(%q): expected %q, got %q", s.value, s.expected, got)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"slices"
+
+	"github.com/disintegration/imaging"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	maxPhotoSize  = 10 << 20
+	maxItemPhotos = 10
+	// maxPhotoPixels guards against small files declaring huge dimensions,
+	// decoding takes 4 bytes per pixel.
+	maxPhotoPixels = 40_000_000
+	// maxConditionPhotos caps the photos of damage claims and check-ins.
+	maxConditionPhotos = 10
+)
+
+var (
+	ErrInvalidImage  = errors.New("only JPEG, PNG and WebP images are allowed")
+	ErrPhotoNotFound = errors.New("photo not found")
+	ErrInvalidOrder  = errors.New("order must list every photo of the item exactly once")
+)
+
+type thumbSize struct {
+	Name   string
+	Field  string
+	Width  int
+	Height int
+	Crop   bool
+}
+
+// thumbSizes are generated on upload, sm is the cover used in the listing.
+var thumbSizes = []thumbSize{
+	{Name: "sm", Field: "thumb_sm", Width: 200, Height: 150, Crop: true},
+	{Name: "md", Field: "thumb_md", Width: 400, Height: 300},
+	{Name: "lg", Field: "thumb_lg", Width: 1200, Height: 900},
+}
+
+type processedPhoto struct {
+	Original []byte
+	Ext      string
+	Thumbs   map[string][]byte
+	ThumbExt string
+
+	img    image.Image
+	format imaging.Format
+}
+
+// processPhoto validates the image, strips its metadata and renders the thumbnails.
+func processPhoto(data []byte) (*processedPhoto, error) {
+	result, err := cleanPhoto(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := renderThumbs(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// cleanPhoto validates the image and strips its metadata, without thumbnails.
+func cleanPhoto(data []byte) (*processedPhoto, error) {
+	if len(data) > maxPhotoSize {
+		return nil, ValidationError{"file": fmt.Sprintf("must be smaller than %d MB", maxPhotoSize>>20)}
+	}
+
+	mime := http.DetectContentType(data)
+	if mime != "image/jpeg" && mime != "image/png" && mime != "image/webp" {
+		return nil, ErrInvalidImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxPhotoPixels {
+		return nil, ValidationError{"file": fmt.Sprintf("must have at most %d megapixels", maxPhotoPixels/1_000_000)}
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	result := &processedPhoto{Thumbs: map[string][]byte{}, img: img, format: imaging.JPEG}
+
+	// re-encoding drops EXIF (GPS, camera serial, ...), there is no WebP
+	// encoder so WebP files only get their metadata chunks removed
+	result.Ext, result.ThumbExt = ".jpg", ".jpg"
+	switch mime {
+	case "image/png":
+		result.format = imaging.PNG
+		result.Ext, result.ThumbExt = ".png", ".png"
+	case "image/webp":
+		result.Ext = ".webp"
+		if result.Original, err = stripWebPMetadata(data); err != nil {
+			return nil, ErrInvalidImage
+		}
+	}
+
+	if result.Original == nil {
+		if result.Original, err = encodeImage(img, result.format); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// renderThumbs fills the thumbnails of a cleaned photo.
+func renderThumbs(p *processedPhoto) error {
+	for _, size := range thumbSizes {
+		var thumb image.Image
+		if size.Crop {
+			thumb = imaging.Fill(p.img, size.Width, size.Height, imaging.Center, imaging.Lanczos)
+		} else {
+			thumb = imaging.Fit(p.img, size.Width, size.Height, imaging.Lanczos)
+		}
+		var err error
+		if p.Thumbs[size.Field], err = encodeImage(thumb, p.format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeImage(img image.Image, format imaging.Format) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, format, imaging.JPEGQuality(85)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stripWebPMetadata drops the EXIF and XMP chunks of a WebP file.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrInvalidImage
+	}
+
+	out := append([]byte{}, data[:12]...)
+	for pos := 12; pos+8 <= len(data); {
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size%2
+		if end > len(data) {
+			return nil, ErrInvalidImage
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[pos:end]...)
+			chunk[8] &^= 0x08 | 0x04 // EXIF and XMP flags
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
+
+func fileURL(record *core.Record, field string) string {
+	name := record.GetString(field)
+	if name == "" {
+		return ""
+	}
+	return "/api/files/" + record.Collection().Id + "/" + record.Id + "/" + name
+}
+
+func exportPhoto(photo *core.Record) map[string]any {
+	url := fileURL(photo, "file")
+	if url == "" {
+		// photos seeded by url only
+		url = photo.GetString("url")
+	}
+
+	thumbs := map[string]string{}
+	for _, size := range thumbSizes {
+		if thumbs[size.Name] = fileURL(photo, size.Field); thumbs[size.Name] == "" {
+			thumbs[size.Name] = url
+		}
+	}
+
+	return map[string]any{
+		"id":     photo.Id,
+		"url":    url,
+		"thumbs": thumbs,
+	}
+}
+
+func exportPhotos(photos []*core.Record) []map[string]any {
+	result := make([]map[string]any, len(photos))
+	for i, p := range photos {
+		result[i] = exportPhoto(p)
+	}
+	return result
+}
+
+// itemCovers returns the small thumbnail of the first photo of every item.
+func itemCovers(app core.App, items []*core.Record) (map[string]string, error) {
+	ids := []string{}
+	for _, item := range items {
+		if photos := item.GetStringSlice("photos"); len(photos) > 0 {
+			ids = append(ids, photos[0])
+		}
+	}
+
+	covers := map[string]string{}
+	if len(ids) == 0 {
+		return covers, nil
+	}
+
+	photos, err := app.FindRecordsByIds("item_photos", ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range photos {
+		covers[p.Id] = exportPhoto(p)["thumbs"].(map[string]string)["sm"]
+	}
+	return covers, nil
+}
+
+func AddItemPhoto(app core.App, itemID, ownerID string, file *filesystem.File) (map[string]any, error) {
+	item, err := findOwnItem(app, itemID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(item.GetStringSlice("photos")) >= maxItemPhotos {
+		return nil, ValidationError{"file": fmt.Sprintf("an item can have at most %d photos", maxItemPhotos)}
+	}
+
+	if file.Size > maxPhotoSize {
+		return nil, ValidationError{"file": fmt.Sprintf("must be smaller than %d MB", maxPhotoSize>>20)}
+	}
+	data, err := readFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	processed, err := processPhoto(data)
+	if err != nil {
+		return nil, err
+	}
+
+	photosCol, err := app.FindCollectionByNameOrId("item_photos")
+	if err != nil {
+		return nil, err
+	}
+
+	photo := core.NewRecord(photosCol)
+	photo.Set("item", item.Id)
+
+	original, err := filesystem.NewFileFromBytes(processed.Original, "photo"+processed.Ext)
+	if err != nil {
+		return nil, err
+	}
+	photo.Set("file", original)
+
+	for _, size := range thumbSizes {
+		thumb, err := filesystem.NewFileFromBytes(processed.Thumbs[size.Field], size.Name+processed.ThumbExt)
+		if err != nil {
+			return nil, err
+		}
+		photo.Set(size.Field, thumb)
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		// the photo was processed outside the transaction, another upload
+		// may have filled the item meanwhile
+		item, err := findOwnItem(txApp, itemID, ownerID)
+		if err != nil {
+			return err
+		}
+		if len(item.GetStringSlice("photos")) >= maxItemPhotos {
+			return ValidationError{"file": fmt.Sprintf("an item can have at most %d photos", maxItemPhotos)}
+		}
+
+		if err := txApp.Save(photo); err != nil {
+			return saveError(err)
+		}
+		item.Set("photos+", photo.Id)
+		return txApp.Save(item)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return exportPhoto(photo), nil
+}
+
+func readFile(file *filesystem.File) ([]byte, error) {
+	r, err := file.Reader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func DeleteItemPhoto(app core.App, itemID, photoID, ownerID string) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		item, err := findOwnItem(txApp, itemID, ownerID)
+		if err != nil {
+			return err
+		}
+
+		photo, err := txApp.FindRecordById("item_photos", photoID)
+		if err != nil || photo.GetString("item") != item.Id {
+			return ErrPhotoNotFound
+		}
+
+		if err := txApp.Delete(photo); err != nil {
+			return err
+		}
+
+		item, err = txApp.FindRecordById("items", item.Id)
+		if err != nil {
+			return err
+		}
+		item.Set("photos-", photo.Id)
+		return txApp.Save(item)
+	})
+}
+
+// ReorderItemPhotos sets the photos order, the first photo becomes the cover.
+func ReorderItemPhotos(app core.App, itemID, ownerID string, order []string) ([]map[string]any, error) {
+	item, err := findOwnItem(app, itemID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := slices.Clone(item.GetStringSlice("photos"))
+	wanted := slices.Clone(order)
+	slices.Sort(current)
+	slices.Sort(wanted)
+	if !slices.Equal(current, wanted) {
+		return nil, ErrInvalidOrder
+	}
+
+	item.Set("photos", order)
+	if err := app.Save(item); err != nil {
+		return nil, saveError(err)
+	}
+
+	_ = app.ExpandRecord(item, []string{"photos"}, nil)
+	return exportPhotos(item.ExpandedAll("photos")), nil
+}
+
+// conditionPhotos checks the photos taken of a rented item and strips their
+// metadata, the files are named after name.
+func conditionPhotos(files []*filesystem.File, name string) ([]*filesystem.File, error) {
+	if len(files) == 0 || len(files) > maxConditionPhotos {
+		return nil, ValidationError{"photos": fmt.Sprintf("must have between 1 and %d photos", maxConditionPhotos)}
+	}
+
+	result := make([]*filesystem.File, len(files))
+	for i, file := range files {
+		if file.Size > maxPhotoSize {
+			return nil, ValidationError{"photos": fmt.Sprintf("must be smaller than %d MB each", maxPhotoSize>>20)}
+		}
+		data, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		processed, err := cleanPhoto(data)
+		if err != nil {
+			return nil, err
+		}
+		if result[i], err = filesystem.NewFileFromBytes(processed.Original, name+processed.Ext); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// protectedFileURLs are the URLs of the files of a protected field, they
+// need a file token.
+func protectedFileURLs(record *core.Record, field string) []string {
+	urls := []string{}
+	for _, name := range record.GetStringSlice(field) {
+		urls = append(urls, "/api/files/"+record.Collection().Id+"/"+record.Id+"/"+name)
+	}
+	return urls
+}
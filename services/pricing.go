@@ -0,0 +1,200 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Rate units of the item price table.
+const (
+	UnitHour  = "hour"
+	UnitDay   = "day"
+	UnitWeek  = "week"
+	UnitMonth = "month"
+)
+
+// Currency is the currency of all item prices.
+const Currency = "KZT"
+
+type rateUnit struct {
+	Unit  string
+	Field string
+	Hours int
+}
+
+// rateUnits are ordered from the longest unit to the shortest.
+var rateUnits = []rateUnit{
+	{UnitMonth, "price_monthly", 30 * 24},
+	{UnitWeek, "price_weekly", 7 * 24},
+	{UnitDay, "price_daily", 24},
+	{UnitHour, "price_hourly", 1},
+}
+
+// RentLengthError is returned when the rent is shorter or longer than the
+// item allows. Zero MinHours/MaxHours mean no limit.
+type RentLengthError struct {
+	Hours    int
+	MinHours int
+	MaxHours int
+}
+
+func (e *RentLengthError) Error() string {
+	return fmt.Sprintf("rent length %dh is outside of the allowed %d-%dh", e.Hours, e.MinHours, e.MaxHours)
+}
+
+type QuoteLine struct {
+	Unit     string  `json:"unit"`
+	Quantity int     `json:"quantity"`
+	Rate     float64 `json:"rate"`
+	Amount   float64 `json:"amount"`
+}
+
+// Quote is the itemized price of renting an item for [From, To).
+type Quote struct {
+	Item     string         `json:"item"`
+	From     types.DateTime `json:"from"`
+	To       types.DateTime `json:"to"`
+	Hours    int            `json:"hours"`
+	Lines    []QuoteLine    `json:"lines"`
+	Rental   float64        `json:"rental"`
+	Deposit  float64        `json:"deposit"`
+	Total    float64        `json:"total"`
+	Currency string         `json:"currency"`
+}
+
+type itemRate struct {
+	rateUnit
+	Rate float64
+}
+
+// itemRates returns the rates the item has, longest unit first. Items
+// without a rate table are priced per day by price.
+func itemRates(item *core.Record) []itemRate {
+	rates := []itemRate{}
+	for _, u := range rateUnits {
+		if rate := item.GetFloat(u.Field); rate > 0 {
+			rates = append(rates, itemRate{u, rate})
+		}
+	}
+	if len(rates) == 0 && item.GetFloat("price") > 0 {
+		rates = append(rates, itemRate{rateUnits[2], item.GetFloat("price")})
+	}
+	return rates
+}
+
+// SetItemPrice keeps price, used for sorting and filtering, at the daily
+// rate, or the cheapest daily equivalent for items without one. A plain
+// price becomes the daily rate.
+func SetItemPrice(item *core.Record) {
+	rates := itemRates(item)
+	if len(rates) == 0 {
+		return
+	}
+	if item.GetFloat("price_daily") <= 0 && len(rates) == 1 && rates[0].Unit == UnitDay {
+		item.Set("price_daily", rates[0].Rate)
+	}
+
+	daily := item.GetFloat("price_daily")
+	if daily <= 0 {
+		daily = math.Inf(1)
+		for _, r := range rates {
+			daily = math.Min(daily, r.Rate*24/float64(r.Hours))
+		}
+	}
+	item.Set("price", roundMoney(daily))
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// cheapestLines prices the hours with the given rates (longest unit first).
+// Every unit may be used whole, rounded up, or skipped, whichever is the
+// cheapest, so six days never cost more than a week.
+func cheapestLines(rates []itemRate, hours int) ([]QuoteLine, float64) {
+	if hours <= 0 || len(rates) == 0 {
+		return nil, 0
+	}
+	r := rates[0]
+	n, rem := hours/r.Hours, hours%r.Hours
+
+	if len(rates) == 1 {
+		if rem > 0 {
+			n++
+		}
+		return []QuoteLine{{Unit: r.Unit, Quantity: n, Rate: r.Rate, Amount: float64(n) * r.Rate}}, float64(n) * r.Rate
+	}
+
+	var best []QuoteLine
+	bestAmount := math.Inf(1)
+	try := func(lines []QuoteLine, amount float64) {
+		if amount < bestAmount {
+			best, bestAmount = lines, amount
+		}
+	}
+
+	// whole units and the rest in shorter ones
+	restLines, restAmount := cheapestLines(rates[1:], rem)
+	if n > 0 {
+		lines := append([]QuoteLine{{Unit: r.Unit, Quantity: n, Rate: r.Rate, Amount: float64(n) * r.Rate}}, restLines...)
+		try(lines, float64(n)*r.Rate+restAmount)
+	}
+	// one more unit instead of the rest
+	if rem > 0 {
+		try([]QuoteLine{{Unit: r.Unit, Quantity: n + 1, Rate: r.Rate, Amount: float64(n+1) * r.Rate}}, float64(n+1)*r.Rate)
+	}
+	// shorter units only
+	try(cheapestLines(rates[1:], hours))
+
+	return best, bestAmount
+}
+
+// quoteItem prices the rent of the item for [from, to), checking the
+// allowed rent length.
+func quoteItem(item *core.Record, from, to types.DateTime) (Quote, error) {
+	if from.IsZero() || to.IsZero() || !to.After(from) {
+		return Quote{}, fmt.Errorf("%w: to must be after from", ErrInvalidDates)
+	}
+
+	hours := int(math.Ceil(to.Time().Sub(from.Time()).Hours()))
+	minHours, maxHours := item.GetInt("min_rental_hours"), item.GetInt("max_rental_hours")
+	if hours < minHours || (maxHours > 0 && hours > maxHours) {
+		return Quote{}, &RentLengthError{Hours: hours, MinHours: minHours, MaxHours: maxHours}
+	}
+
+	lines, rental := cheapestLines(itemRates(item), hours)
+	if lines == nil {
+		lines = []QuoteLine{}
+	}
+	for i := range lines {
+		lines[i].Amount = roundMoney(lines[i].Amount)
+	}
+	deposit := item.GetFloat("deposit")
+
+	return Quote{
+		Item:     item.Id,
+		From:     from,
+		To:       to,
+		Hours:    hours,
+		Lines:    lines,
+		Rental:   roundMoney(rental),
+		Deposit:  deposit,
+		Total:    roundMoney(rental + deposit),
+		Currency: Currency,
+	}, nil
+}
+
+func QuoteItem(app core.App, itemID string, from, to types.DateTime) (Quote, error) {
+	item, err := app.FindRecordById("items", itemID)
+	if err != nil {
+		return Quote{}, ErrItemNotFound
+	}
+	if from.Time().Before(startOfDay(time.Now())) {
+		return Quote{}, ErrDatesInPast
+	}
+	return quoteItem(item, from, to)
+}
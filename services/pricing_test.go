@@ -0,0 +1,48 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCheapestLines(t *testing.T) {
+	week := itemRate{rateUnits[1], 5000}
+	day := itemRate{rateUnits[2], 1000}
+	hour := itemRate{rateUnits[3], 200}
+
+	scenarios := []struct {
+		name   string
+		rates  []itemRate
+		hours  int
+		lines  []QuoteLine
+		amount float64
+	}{
+		{"no hours", []itemRate{day}, 0, nil, 0},
+		{"no rates", nil, 24, nil, 0},
+		{"single rate rounds up", []itemRate{day}, 25, []QuoteLine{{UnitDay, 2, 1000, 2000}}, 2000},
+		{"whole days", []itemRate{week, day}, 3 * 24, []QuoteLine{{UnitDay, 3, 1000, 3000}}, 3000},
+		{"six days cost a week", []itemRate{week, day}, 6 * 24, []QuoteLine{{UnitWeek, 1, 5000, 5000}}, 5000},
+		{
+			"week and a day", []itemRate{week, day}, 8 * 24,
+			[]QuoteLine{{UnitWeek, 1, 5000, 5000}, {UnitDay, 1, 1000, 1000}}, 6000,
+		},
+		{"a few hours", []itemRate{day, hour}, 4, []QuoteLine{{UnitHour, 4, 200, 800}}, 800},
+		{"hours rounded up to a day", []itemRate{day, hour}, 6, []QuoteLine{{UnitDay, 1, 1000, 1000}}, 1000},
+		{
+			"day and hours", []itemRate{day, hour}, 26,
+			[]QuoteLine{{UnitDay, 1, 1000, 1000}, {UnitHour, 2, 200, 400}}, 1400,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			lines, amount := cheapestLines(s.rates, s.hours)
+			if !slices.Equal(lines, s.lines) {
+				t.Fatalf("Expected lines %v, got %v", s.lines, lines)
+			}
+			if amount != s.amount {
+				t.Fatalf("Expected amount %v, got %v", s.amount, amount)
+			}
+		})
+	}
+}
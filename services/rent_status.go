@@ -0,0 +1,228 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	StatusRequested  = "requested"
+	StatusApproved   = "approved"
+	StatusHandedOver = "handed_over"
+	StatusReturned   = "returned"
+	StatusClosed     = "closed"
+	StatusCancelled  = "cancelled"
+	StatusDeclined   = "declined"
+	StatusDisputed   = "disputed"
+)
+
+const (
+	PartyOwner  = "owner"
+	PartyRenter = "renter"
+)
+
+var (
+	ErrRentNotFound         = errors.New("rent not found")
+	ErrNotRentParty         = errors.New("you are not a party of this rent")
+	ErrUnknownStatus        = errors.New("unknown status")
+	ErrTransitionNotAllowed = errors.New("status transition is not allowed")
+	ErrWrongParty           = errors.New("this transition must be made by the other party")
+)
+
+// rentTransitions lists allowed moves: from -> to -> parties allowed to make them.
+// The handover and the return are made by the renter confirming a check-in
+// of the owner (see ConfirmCheckin), not by a transition.
+var rentTransitions = map[string]map[string][]string{
+	StatusRequested: {
+		StatusApproved:  {PartyOwner},
+		StatusDeclined:  {PartyOwner},
+		StatusCancelled: {PartyRenter},
+	},
+	StatusApproved: {
+		StatusCancelled: {PartyOwner, PartyRenter},
+	},
+	StatusHandedOver: {
+		StatusDisputed: {PartyOwner, PartyRenter},
+	},
+	// after the return a dispute is opened by contesting a damage claim
+	StatusReturned: {
+		StatusClosed: {PartyOwner},
+	},
+}
+
+// inactiveRentStatuses don't block the item calendar.
+var inactiveRentStatuses = []string{StatusCancelled, StatusDeclined}
+
+type TransitionInput struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+func findStatus(app core.App, name string) (*core.Record, error) {
+	status, err := app.FindFirstRecordByData("statuses", "name", name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStatus, name)
+	}
+	return status, nil
+}
+
+// rentStatusName returns the name of the rent status, rents without one
+// count as requested.
+func rentStatusName(app core.App, rent *core.Record) string {
+	if current, err := app.FindRecordById("statuses", rent.GetString("status")); err == nil {
+		return current.GetString("name")
+	}
+	return StatusRequested
+}
+
+// rentParty returns whether the user is the item owner or the renter of the rent.
+func rentParty(app core.App, rent *core.Record, userID string) (string, error) {
+	if rent.GetString("renter") == userID {
+		return PartyRenter, nil
+	}
+	item, err := app.FindRecordById("items", rent.GetString("item"))
+	if err != nil {
+		return "", err
+	}
+	if item.GetString("author") == userID {
+		return PartyOwner, nil
+	}
+	return "", ErrNotRentParty
+}
+
+func canTransition(from, to, party string) error {
+	allowed, ok := rentTransitions[from][to]
+	if !ok {
+		return fmt.Errorf("%w: %s -> %s", ErrTransitionNotAllowed, from, to)
+	}
+	for _, p := range allowed {
+		if p == party {
+			return nil
+		}
+	}
+	return ErrWrongParty
+}
+
+// setRentStatus updates the rent status and writes the history entry.
+// Must be called inside a transaction.
+func setRentStatus(txApp core.App, rent *core.Record, to *core.Record, actorID, note string) error {
+	historyCol, err := txApp.FindCollectionByNameOrId("rent_status_history")
+	if err != nil {
+		return err
+	}
+
+	from := rent.GetString("status")
+	rent.Set("status", to.Id)
+	if err := txApp.Save(rent); err != nil {
+		return err
+	}
+
+	entry := core.NewRecord(historyCol)
+	entry.Set("rent", rent.Id)
+	entry.Set("from_status", from)
+	entry.Set("to_status", to.Id)
+	entry.Set("actor", actorID)
+	entry.Set("note", note)
+
+	return txApp.Save(entry)
+}
+
+// prepareTransition makes the changes that come with moving the rent to
+// status, besides the status itself. Must be called inside the transaction
+// that moves it.
+func prepareTransition(txApp core.App, rent *core.Record, from, to, party string, now time.Time) error {
+	at, _ := types.ParseDateTime(now)
+	switch to {
+	case StatusCancelled:
+		return cancelRent(txApp, rent, from, party)
+	case StatusHandedOver:
+		rent.Set("handed_over_at", at)
+	case StatusReturned:
+		rent.Set("returned_at", at)
+		startClaimWindow(rent, now)
+	case StatusClosed:
+		return checkNoOpenClaim(txApp, rent)
+	}
+	return nil
+}
+
+// finishTransition settles the payments of a rent that moved to status and
+// returns its fresh export.
+func finishTransition(app core.App, rent *core.Record, status string) map[string]any {
+	// the status change stands even if the provider fails, the payments
+	// can be settled again from the logs
+	if err := settleRentPayments(app, rent, status); err != nil {
+		app.Logger().Error("settling rent payments failed", "rent", rent.Id, "status", status, "error", err.Error())
+	}
+	if fresh, err := app.FindRecordById("rents", rent.Id); err == nil {
+		rent = fresh
+	}
+
+	_ = app.ExpandRecord(rent, []string{"status"}, nil)
+	return rent.PublicExport()
+}
+
+func TransitionRent(app core.App, rentID, actorID string, in TransitionInput) (map[string]any, error) {
+	var rent *core.Record
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		rent, err = txApp.FindRecordById("rents", rentID)
+		if err != nil {
+			return ErrRentNotFound
+		}
+
+		party, err := rentParty(txApp, rent, actorID)
+		if err != nil {
+			return err
+		}
+
+		to, err := findStatus(txApp, in.Status)
+		if err != nil {
+			return err
+		}
+
+		from := rentStatusName(txApp, rent)
+		if err := canTransition(from, to.GetString("name"), party); err != nil {
+			return err
+		}
+		if err := prepareTransition(txApp, rent, from, to.GetString("name"), party, time.Now()); err != nil {
+			return err
+		}
+
+		return setRentStatus(txApp, rent, to, actorID, in.Note)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return finishTransition(app, rent, in.Status), nil
+}
+
+func RentStatusHistory(app core.App, rentID, userID string) ([]map[string]any, error) {
+	rent, err := app.FindRecordById("rents", rentID)
+	if err != nil {
+		return nil, ErrRentNotFound
+	}
+	if _, err := rentParty(app, rent, userID); err != nil {
+		return nil, err
+	}
+
+	records, err := app.FindRecordsByFilter("rent_status_history", "rent = {:rent}", "created", 0, 0, dbx.Params{"rent": rent.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	_ = app.ExpandRecords(records, []string{"from_status", "to_status"}, nil)
+
+	history := make([]map[string]any, len(records))
+	for i, r := range records {
+		history[i] = r.PublicExport()
+	}
+	return history, nil
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	scenarios := []struct {
+		from     string
+		to       string
+		party    string
+		expected error
+	}{
+		{StatusRequested, StatusApproved, PartyOwner, nil},
+		{StatusRequested, StatusApproved, PartyRenter, ErrWrongParty},
+		{StatusRequested, StatusDeclined, PartyOwner, nil},
+		{StatusRequested, StatusCancelled, PartyRenter, nil},
+		{StatusRequested, StatusCancelled, PartyOwner, ErrWrongParty},
+		{StatusApproved, StatusCancelled, PartyOwner, nil},
+		{StatusApproved, StatusCancelled, PartyRenter, nil},
+		{StatusApproved, StatusHandedOver, PartyOwner, ErrTransitionNotAllowed},
+		{StatusHandedOver, StatusDisputed, PartyRenter, nil},
+		{StatusHandedOver, StatusReturned, PartyRenter, ErrTransitionNotAllowed},
+		{StatusReturned, StatusClosed, PartyOwner, nil},
+		{StatusReturned, StatusClosed, PartyRenter, ErrWrongParty},
+		{StatusClosed, StatusRequested, PartyOwner, ErrTransitionNotAllowed},
+		{StatusRequested, "unknown", PartyOwner, ErrTransitionNotAllowed},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.from+"->"+s.to+" by "+s.party, func(t *testing.T) {
+			err := canTransition(s.from, s.to, s.party)
+			if s.expected == nil && err != nil {
+				t.Fatalf("Expected the transition to be allowed, got %v", err)
+			}
+			if s.expected != nil && !errors.Is(err, s.expected) {
+				t.Fatalf("Expected %v, got %v", s.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+var (
+	ErrItemNotFound = errors.New("item not found")
+	ErrOwnItem      = errors.New("you can't rent your own item")
+	ErrInvalidDates = errors.New("invalid rent dates")
+	ErrDatesInPast  = errors.New("date_start is in the past")
+)
+
+type RentInput struct {
+	Item      string `json:"item"`
+	DateStart string `json:"date_start"`
+	DateEnd   string `json:"date_end"`
+}
+
+// RentConflictError is returned when the requested dates overlap an existing rent.
+type RentConflictError struct {
+	RentID    string
+	DateStart types.DateTime
+	DateEnd   types.DateTime
+}
+
+func (e *RentConflictError) Error() string {
+	return fmt.Sprintf("item is already booked from %s to %s", e.DateStart, e.DateEnd)
+}
+
+func parseRentDates(startRaw, endRaw string) (types.DateTime, types.DateTime, error) {
+	start, err := types.ParseDateTime(startRaw)
+	if err != nil || start.IsZero() {
+		return start, start, fmt.Errorf("%w: bad date_start %q", ErrInvalidDates, startRaw)
+	}
+	end, err := types.ParseDateTime(endRaw)
+	if err != nil || end.IsZero() {
+		return start, end, fmt.Errorf("%w: bad date_end %q", ErrInvalidDates, endRaw)
+	}
+	if !end.After(start) {
+		return start, end, fmt.Errorf("%w: date_end must be after date_start", ErrInvalidDates)
+	}
+	return start, end, nil
+}
+
+// activeRentsOverlapping returns active rents of the item that intersect [start, end).
+// date_end is the return day, so a new rent may start on the day the previous one ends.
+func activeRentsOverlapping(app core.App, itemID string, start, end types.DateTime, limit int) ([]*core.Record, error) {
+	parts := []string{"item = {:item}", "date_start < {:end}", "date_end > {:start}"}
+	params := dbx.Params{"item": itemID, "start": start.String(), "end": end.String()}
+	for i, name := range inactiveRentStatuses {
+		key := fmt.Sprintf("inactive%d", i)
+		parts = append(parts, "status.name != {:"+key+"}")
+		params[key] = name
+	}
+
+	return app.FindRecordsByFilter("rents", strings.Join(parts, " && "), "date_start", limit, 0, params)
+}
+
+func findOverlappingRent(app core.App, itemID string, start, end types.DateTime) (*core.Record, error) {
+	records, err := activeRentsOverlapping(app, itemID, start, end, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+func CreateRent(app core.App, renterID string, in RentInput) (map[string]any, error) {
+	start, end, err := parseRentDates(in.DateStart, in.DateEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if start.Time().Before(today) {
+		return nil, ErrDatesInPast
+	}
+
+	var rent *core.Record
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		item, err := txApp.FindRecordById("items", in.Item)
+		if err != nil {
+			return ErrItemNotFound
+		}
+		if item.GetString("author") == renterID {
+			return ErrOwnItem
+		}
+		quote, err := quoteItem(item, start, end)
+		if err != nil {
+			return err
+		}
+
+		existing, err := findOverlappingRent(txApp, item.Id, start, end)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return &RentConflictError{
+				RentID:    existing.Id,
+				DateStart: existing.GetDateTime("date_start"),
+				DateEnd:   existing.GetDateTime("date_end"),
+			}
+		}
+
+		rentsCol, err := txApp.FindCollectionByNameOrId("rents")
+		if err != nil {
+			return err
+		}
+
+		requested, err := findStatus(txApp, StatusRequested)
+		if err != nil {
+			return err
+		}
+
+		rent = core.NewRecord(rentsCol)
+		rent.Set("item", item.Id)
+		rent.Set("renter", renterID)
+		rent.Set("date_start", start)
+		rent.Set("date_end", end)
+		// the price is fixed when the rent is requested
+		rent.Set("amount", quote.Rental)
+		rent.Set("deposit", quote.Deposit)
+		rent.Set("quote", quote)
+		rent.Set("cancellation_policy", rentPolicy(rent, item))
+		rent.Set("payment_status", RentUnpaid)
+		rent.Set("deposit_status", DepositNone)
+
+		return setRentStatus(txApp, rent, requested, renterID, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_ = app.ExpandRecord(rent, []string{"status"}, nil)
+	return rent.PublicExport(), nil
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// editorTags are the tags kept in item descriptions with their allowed attributes.
+var editorTags = map[string][]string{
+	"p": nil, "br": nil, "b": nil, "strong": nil, "i": nil, "em": nil, "u": nil, "s": nil,
+	"ul": nil, "ol": nil, "li": nil, "h2": nil, "h3": nil, "blockquote": nil,
+	"a": {"href"},
+}
+
+var voidTags = map[string]bool{"br": true}
+
+// droppedTags are removed together with their content.
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true,
+	"noscript": true, "template": true, "svg": true, "math": true,
+}
+
+func safeHref(href string) bool {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// SanitizeHTML keeps only the editorTags, drops everything else and closes
+// tags left open.
+func SanitizeHTML(input string) string {
+	z := html.NewTokenizer(strings.NewReader(input))
+
+	var b strings.Builder
+	open := []string{}
+	skip := 0
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				b.WriteString("</" + open[i] + ">")
+			}
+			return strings.TrimSpace(b.String())
+
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(string(z.Text())))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if droppedTags[tok.Data] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			allowedAttrs, ok := editorTags[tok.Data]
+			if skip > 0 || !ok {
+				continue
+			}
+
+			b.WriteString("<" + tok.Data)
+			for _, attr := range tok.Attr {
+				for _, allowed := range allowedAttrs {
+					if attr.Key == allowed && (attr.Key != "href" || safeHref(attr.Val)) {
+						b.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+					}
+				}
+			}
+			if tok.Data == "a" {
+				b.WriteString(` rel="nofollow noopener"`)
+			}
+			b.WriteString(">")
+
+			if !voidTags[tok.Data] && tt == html.StartTagToken {
+				open = append(open, tok.Data)
+			} else if !voidTags[tok.Data] {
+				b.WriteString("</" + tok.Data + ">")
+			}
+
+		case html.EndTagToken:
+			tok := z.Token()
+			if droppedTags[tok.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			// close up to the matching open tag, stray closing tags are ignored
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != tok.Data {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+}
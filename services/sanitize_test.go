@@ -0,0 +1,38 @@
+package services
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"plain text", "  Палатка на 4 человека ", "Палатка на 4 человека"},
+		{"escaped text", "a < b & c", "a &lt; b &amp; c"},
+		{"allowed tags", "<p>Hello <b>world</b></p>", "<p>Hello <b>world</b></p>"},
+		{"unknown tag keeps its text", "<div>text</div>", "text"},
+		{"dropped tag content", "<script>alert(1)</script><p>ok</p>", "<p>ok</p>"},
+		{"nested dropped tags", "<svg><script>x</script></svg>ok", "ok"},
+		{"attributes stripped", `<p onclick="x()" class="c">hi</p>`, "<p>hi</p>"},
+		{
+			"safe link",
+			`<a href="https://example.com" title="t">x</a>`,
+			`<a href="https://example.com" rel="nofollow noopener">x</a>`,
+		},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `<a rel="nofollow noopener">x</a>`},
+		{"void tag", "<br/>line", "<br>line"},
+		{"unclosed tags", "<p>open <b>bold", "<p>open <b>bold</b></p>"},
+		{"misnested tags", "<p><b>x</p>", "<p><b>x</b></p>"},
+		{"stray closing tag", "</b>text", "text"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if got := SanitizeHTML(s.input); got != s.expected {
+				t.Fatalf("Expected %q, got %q", s.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// items_fts is an FTS5 table over the item text. Cyrillic/Kazakh case folding
+// is done by the unicode61 tokenizer, stemming is done on the query side:
+// every search word is reduced to its stem and matched as a prefix.
+
+const searchSnippetTokens = 12
+
+// snippetOpen and snippetClose mark the matches in the snippets, private use
+// characters that are stripped from the indexed text. The snippet is HTML
+// escaped before they become <mark> tags.
+const (
+	snippetOpen  = "\uE000"
+	snippetClose = "\uE001"
+)
+
+// indexReplacer prepares text for the index like yoReplacer and drops the
+// snippet markers.
+var indexReplacer = strings.NewReplacer("ё", "е", "Ё", "Е", snippetOpen, "", snippetClose, "")
+
+var snippetMarks = strings.NewReplacer(snippetOpen, "<mark>", snippetClose, "</mark>")
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// stemSuffixes are common Russian and Kazakh inflection endings, longest first.
+var stemSuffixes = []string{
+	// russian
+	"иями", "ями", "ами", "ого", "его", "ому", "ему", "ыми", "ими", "ешь", "ишь", "ать", "ять", "ить", "еть",
+	"ая", "яя", "ое", "ее", "ые", "ие", "ый", "ий", "ой", "ом", "ем", "ам", "ям", "ах", "ях", "ов", "ев", "ей", "ую", "юю", "ию",
+	// kazakh
+	"лардың", "лердің", "дардың", "дердің", "тардың", "тердің",
+	"ның", "нің", "дың", "дің", "тың", "тің",
+	"дан", "ден", "тан", "тен", "нан", "нен",
+	"мен", "бен", "пен",
+	"лар", "лер", "дар", "дер", "тар", "тер",
+	"ға", "ге", "қа", "ке", "да", "де", "та", "те", "ды", "ді", "ты", "ті", "ны", "ні",
+	// single letters
+	"а", "я", "о", "е", "ы", "и", "у", "ю", "ь", "й",
+}
+
+func init() {
+	// longest match wins
+	sort.SliceStable(stemSuffixes, func(i, j int) bool {
+		return utf8.RuneCountInString(stemSuffixes[i]) > utf8.RuneCountInString(stemSuffixes[j])
+	})
+}
+
+// yoReplacer folds ё into е, the tokenizer doesn't treat them as the same letter.
+var yoReplacer = strings.NewReplacer("ё", "е", "Ё", "Е")
+
+func foldWord(word string) string {
+	return yoReplacer.Replace(strings.ToLower(word))
+}
+
+// stemWord strips a single inflection ending while keeping at least 3 letters.
+func stemWord(word string) string {
+	word = foldWord(word)
+	n := utf8.RuneCountInString(word)
+	for _, suffix := range stemSuffixes {
+		if strings.HasSuffix(word, suffix) && n-utf8.RuneCountInString(suffix) >= 3 {
+			return strings.TrimSuffix(word, suffix)
+		}
+	}
+	return word
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ftsQuery converts the user search into an FTS5 MATCH expression.
+func ftsQuery(text string) string {
+	terms := []string{}
+	for _, word := range searchWords(text) {
+		terms = append(terms, `"`+strings.ReplaceAll(stemWord(word), `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func plainText(editorHTML string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTagRegex.ReplaceAllString(editorHTML, " "))), " ")
+}
+
+// allTranslations joins the field in every language, so that a search in
+// any of them finds the item.
+func allTranslations(item *core.Record, field string) string {
+	parts := []string{}
+	for _, lang := range Languages {
+		if v := strings.TrimSpace(item.GetString(translatedField(field, lang))); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// IndexItem (re)writes the search row of the item.
+func IndexItem(app core.App, item *core.Record) error {
+	if err := UnindexItem(app, item.Id); err != nil {
+		return err
+	}
+
+	_, err := app.DB().NewQuery(
+		"INSERT INTO items_fts (item_id, title, description, tags) VALUES ({:id}, {:title}, {:description}, {:tags})",
+	).Bind(dbx.Params{
+		"id":          item.Id,
+		"title":       indexReplacer.Replace(allTranslations(item, "title")),
+		"description": indexReplacer.Replace(plainText(allTranslations(item, "description"))),
+		"tags":        indexReplacer.Replace(item.GetString("tags")),
+	}).Execute()
+
+	return err
+}
+
+func UnindexItem(app core.App, itemID string) error {
+	_, err := app.DB().NewQuery("DELETE FROM items_fts WHERE item_id = {:id}").
+		Bind(dbx.Params{"id": itemID}).
+		Execute()
+	return err
+}
+
+// ReindexItems rebuilds the whole search table.
+func ReindexItems(app core.App) error {
+	if _, err := app.DB().NewQuery("DELETE FROM items_fts").Execute(); err != nil {
+		return err
+	}
+
+	items, err := app.FindAllRecords("items")
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := IndexItem(app, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func searchMatchExpr(query string) dbx.Expression {
+	return dbx.NewExp(
+		"[[items.id]] IN (SELECT item_id FROM items_fts WHERE items_fts MATCH {:fts_query})",
+		dbx.Params{"fts_query": query},
+	)
+}
+
+// orderByRelevance sorts the items query by bm25 (title > tags > description).
+func orderByRelevance(q *dbx.SelectQuery, query string, desc bool) {
+	q.LeftJoin(
+		"(SELECT item_id, bm25(items_fts, 0.0, 10.0, 1.0, 5.0) AS rank FROM items_fts WHERE items_fts MATCH {:fts_query}) fts_rank",
+		dbx.NewExp("[[fts_rank.item_id]] = [[items.id]]", dbx.Params{"fts_query": query}),
+	)
+	// bm25 is lower for better matches
+	q.AndOrderBy("[[fts_rank.rank]]" + sortDirection(desc))
+}
+
+// searchSnippets returns highlighted fragments for the given items, HTML
+// escaped with the matches in <mark>.
+func searchSnippets(app core.App, query string, itemIDs []string) (map[string]string, error) {
+	snippets := map[string]string{}
+	if len(itemIDs) == 0 {
+		return snippets, nil
+	}
+
+	ids := make([]any, len(itemIDs))
+	for i, id := range itemIDs {
+		ids[i] = id
+	}
+
+	rows := []struct {
+		ItemID  string `db:"item_id"`
+		Snippet string `db:"snippet"`
+	}{}
+	err := app.DB().Select("item_id", "snippet(items_fts, -1, {:snippet_open}, {:snippet_close}, '…', {:snippet_tokens}) AS snippet").
+		From("items_fts").
+		Where(dbx.NewExp("items_fts MATCH {:fts_query}", dbx.Params{
+			"fts_query":      query,
+			"snippet_open":   snippetOpen,
+			"snippet_close":  snippetClose,
+			"snippet_tokens": searchSnippetTokens,
+		})).
+		AndWhere(dbx.In("item_id", ids...)).
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		snippets[row.ItemID] = snippetMarks.Replace(html.EscapeString(row.Snippet))
+	}
+	return snippets, nil
+}
@@ -0,0 +1,26 @@
+package services
+
+import "testing"
+
+func TestStemWord(t *testing.T) {
+	scenarios := []struct {
+		word     string
+		expected string
+	}{
+		{"палатка", "палатк"},
+		{"Палатки", "палатк"},
+		{"машинами", "машин"},
+		{"ёлка", "елк"},
+		{"дом", "дом"},
+		{"кітаптар", "кітап"},
+		{"балалардың", "бала"},
+		{"Bosch", "bosch"},
+		{"", ""},
+	}
+
+	for _, s := range scenarios {
+		if got := stemWord(s.word); got != s.expected {
+			t.Errorf("stemWord(%q): expected %q, got %q", s.word, s.expected, got)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+)
+
+const (
+	sortPrice      = "price"
+	sortCreated    = "created"
+	sortPopularity = "popularity"
+)
+
+// SortError is returned for a sort the items list can't apply, Value tells
+// the client what is wrong with it.
+type SortError struct {
+	Value string
+}
+
+func (e *SortError) Error() string {
+	return "invalid sort: " + e.Value
+}
+
+// ItemSortKeys are the keys accepted by the items sort, "-" prefix for desc.
+var ItemSortKeys = []string{sortPrice, sortCreated, sortPopularity, sortDistance, sortRelevance}
+
+// popularitySQL counts favorites plus rents that weren't cancelled or declined.
+var popularitySQL = "((SELECT COUNT(*) FROM [[favorite_items]] WHERE [[favorite_items.item]] = [[items.id]]) + " +
+	"(SELECT COUNT(*) FROM [[rents]] LEFT JOIN [[statuses]] ON [[statuses.id]] = [[rents.status]]" +
+	" WHERE [[rents.item]] = [[items.id]] AND COALESCE([[statuses.name]], '') NOT IN ('" +
+	strings.Join(inactiveRentStatuses, "', '") + "')))"
+
+type itemSort struct {
+	Key  string
+	Desc bool
+}
+
+func (s itemSort) String() string {
+	if s.Desc {
+		return "-" + s.Key
+	}
+	return s.Key
+}
+
+func sortDirection(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
+
+// parseItemSorts parses a comma separated list like "-popularity,price".
+func parseItemSorts(raw string) ([]itemSort, error) {
+	sorts := []itemSort{}
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		s := itemSort{Key: strings.TrimPrefix(part, "+")}
+		if strings.HasPrefix(part, "-") {
+			s = itemSort{Key: part[1:], Desc: true}
+		}
+
+		if !slices.Contains(ItemSortKeys, s.Key) {
+			return nil, &SortError{Value: fmt.Sprintf("unknown key %q", part)}
+		}
+		if seen[s.Key] {
+			return nil, &SortError{Value: fmt.Sprintf("duplicate key %q", s.Key)}
+		}
+		seen[s.Key] = true
+		sorts = append(sorts, s)
+	}
+
+	return sorts, nil
+}
+
+// ValidateItemSort checks a client sort before the items list runs any
+// query, relevance is only accepted together with a search.
+func ValidateItemSort(raw, search string) error {
+	sorts, err := parseItemSorts(raw)
+	if err != nil {
+		return err
+	}
+	for _, s := range sorts {
+		if s.Key == sortRelevance && ftsQuery(search) == "" {
+			return &SortError{Value: "relevance needs a search query"}
+		}
+	}
+	return nil
+}
+
+// orderItems applies the sorts to the items query, the id keeps the order
+// stable between pages.
+func orderItems(q *dbx.SelectQuery, sorts []itemSort, f ItemsFilter, searchQuery string) error {
+	for _, s := range sorts {
+		switch s.Key {
+		case sortPrice, sortCreated:
+			q.AndOrderBy("[[items." + s.Key + "]]" + sortDirection(s.Desc))
+		case sortPopularity:
+			q.AndOrderBy(popularitySQL + sortDirection(s.Desc))
+		case sortDistance:
+			if f.Lat == nil || f.Lng == nil {
+				return ErrDistanceNeedsPoint
+			}
+			orderByDistance(q, *f.Lat, *f.Lng, s.Desc)
+		case sortRelevance:
+			if searchQuery == "" {
+				return &SortError{Value: "relevance needs a search query"}
+			}
+			orderByRelevance(q, searchQuery, s.Desc)
+		}
+	}
+	q.AndOrderBy("[[items.id]] ASC")
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseItemSorts(t *testing.T) {
+	scenarios := []struct {
+		raw       string
+		expected  []itemSort
+		expectErr bool
+	}{
+		{"price", []itemSort{{Key: sortPrice}}, false},
+		{"+created", []itemSort{{Key: sortCreated}}, false},
+		{"-popularity,price", []itemSort{{Key: sortPopularity, Desc: true}, {Key: sortPrice}}, false},
+		{" price , -created ", []itemSort{{Key: sortPrice}, {Key: sortCreated, Desc: true}}, false},
+		{"-distance,relevance", []itemSort{{Key: sortDistance, Desc: true}, {Key: sortRelevance}}, false},
+		{"", nil, true},
+		{"-", nil, true},
+		{"title", nil, true},
+		{"price,", nil, true},
+		{"price,-price", nil, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.raw, func(t *testing.T) {
+			sorts, err := parseItemSorts(s.raw)
+
+			var sortErr *SortError
+			if s.expectErr != errors.As(err, &sortErr) {
+				t.Fatalf("Expected SortError %v, got %v", s.expectErr, err)
+			}
+			if !slices.Equal(sorts, s.expected) {
+				t.Fatalf("Expected %v, got %v", s.expected, sorts)
+			}
+		})
+	}
+}
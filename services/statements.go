@@ -0,0 +1,215 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"uley_be/pdf"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+type StatementRent struct {
+	Rent       string  `db:"rent" json:"rent"`
+	Item       string  `db:"item" json:"item"`
+	Title      string  `db:"title" json:"title"`
+	DateStart  string  `db:"date_start" json:"date_start"`
+	DateEnd    string  `db:"date_end" json:"date_end"`
+	Gross      float64 `db:"gross" json:"gross"`
+	Refunded   float64 `db:"refunded" json:"refunded"`
+	Commission float64 `db:"commission" json:"commission"`
+	Net        float64 `db:"net" json:"net"`
+}
+
+type StatementPayout struct {
+	Id      string  `json:"id"`
+	Amount  float64 `json:"amount"`
+	Status  string  `json:"status"`
+	Created string  `json:"created"`
+}
+
+type StatementTotals struct {
+	Gross      float64 `json:"gross"`
+	Refunded   float64 `json:"refunded"`
+	Commission float64 `json:"commission"`
+	Net        float64 `json:"net"`
+	PaidOut    float64 `json:"paid_out"`
+}
+
+// Statement is the owner's earnings of one calendar month (UTC), by the
+// date the money moved.
+type Statement struct {
+	Owner    string            `json:"owner"`
+	Month    string            `json:"month"`
+	Currency string            `json:"currency"`
+	Rents    []StatementRent   `json:"rents"`
+	Payouts  []StatementPayout `json:"payouts"`
+	Totals   StatementTotals   `json:"totals"`
+}
+
+// ParseStatementMonth reads a YYYY-MM month.
+func ParseStatementMonth(month string) (time.Time, error) {
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, ParamErrors{"month": "must be YYYY-MM"}
+	}
+	return start, nil
+}
+
+// GetOwnerStatement lists every rent of the owner that had a charge, a
+// refund or a damage payment in the month with its commission and net
+// amount, and the payouts made in it.
+func GetOwnerStatement(app core.App, ownerID string, month time.Time) (Statement, error) {
+	from, err := types.ParseDateTime(month)
+	if err != nil {
+		return Statement{}, err
+	}
+	to, err := types.ParseDateTime(month.AddDate(0, 1, 0))
+	if err != nil {
+		return Statement{}, err
+	}
+	period := dbx.Params{"from": from.String(), "to": to.String()}
+
+	// the entries that touched the owner's payable account, with the
+	// renter side (cash) and the commission side of each
+	rents := []StatementRent{}
+	err = app.DB().
+		Select(
+			"ledger_entries.rent AS rent",
+			"items.id AS item",
+			"items.title AS title",
+			"rents.date_start AS date_start",
+			"rents.date_end AS date_end",
+			"COALESCE(SUM(CASE WHEN [[ll.account]] = 'cash' THEN [[ll.debit]] END), 0) AS gross",
+			"COALESCE(SUM(CASE WHEN [[ll.account]] = 'cash' THEN [[ll.credit]] END), 0) AS refunded",
+			"COALESCE(SUM(CASE WHEN [[ll.account]] = 'commission' THEN [[ll.credit]] - [[ll.debit]] END), 0) AS commission",
+			"COALESCE(SUM(CASE WHEN [[ll.account]] = 'owner_payable' THEN [[ll.credit]] - [[ll.debit]] END), 0) AS net",
+		).
+		From("ledger_entries").
+		InnerJoin("ledger_lines ll", dbx.NewExp("[[ll.entry]] = [[ledger_entries.id]]")).
+		InnerJoin("rents", dbx.NewExp("[[rents.id]] = [[ledger_entries.rent]]")).
+		InnerJoin("items", dbx.NewExp("[[items.id]] = [[rents.item]]")).
+		Where(dbx.In("ledger_entries.kind", EntryCharge, EntryRefund, EntryDamage)).
+		AndWhere(dbx.NewExp(
+			"EXISTS (SELECT 1 FROM [[ledger_lines]] own WHERE [[own.entry]] = [[ledger_entries.id]] AND [[own.account]] = {:account} AND [[own.owner]] = {:owner})",
+			dbx.Params{"account": AccountOwnerPayable, "owner": ownerID},
+		)).
+		AndWhere(dbx.NewExp("[[ledger_entries.created]] >= {:from} AND [[ledger_entries.created]] < {:to}", period)).
+		GroupBy("ledger_entries.rent").
+		OrderBy("rents.date_start", "ledger_entries.rent").
+		All(&rents)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	statement := Statement{
+		Owner:    ownerID,
+		Month:    month.Format("2006-01"),
+		Currency: Currency,
+		Rents:    rents,
+		Payouts:  []StatementPayout{},
+	}
+	for i := range statement.Rents {
+		r := &statement.Rents[i]
+		r.Gross = roundMoney(r.Gross)
+		r.Refunded = roundMoney(r.Refunded)
+		r.Commission = roundMoney(r.Commission)
+		r.Net = roundMoney(r.Net)
+		statement.Totals.Gross += r.Gross
+		statement.Totals.Refunded += r.Refunded
+		statement.Totals.Commission += r.Commission
+		statement.Totals.Net += r.Net
+	}
+
+	payouts, err := app.FindRecordsByFilter(
+		"payouts",
+		"owner = {:owner} && created >= {:from} && created < {:to}",
+		"created", 0, 0,
+		dbx.Params{"owner": ownerID, "from": period["from"], "to": period["to"]},
+	)
+	if err != nil {
+		return Statement{}, err
+	}
+	for _, payout := range payouts {
+		statement.Payouts = append(statement.Payouts, StatementPayout{
+			Id:      payout.Id,
+			Amount:  payout.GetFloat("amount"),
+			Status:  payout.GetString("status"),
+			Created: payout.GetString("created"),
+		})
+		statement.Totals.PaidOut += payout.GetFloat("amount")
+	}
+
+	statement.Totals.Gross = roundMoney(statement.Totals.Gross)
+	statement.Totals.Refunded = roundMoney(statement.Totals.Refunded)
+	statement.Totals.Commission = roundMoney(statement.Totals.Commission)
+	statement.Totals.Net = roundMoney(statement.Totals.Net)
+	statement.Totals.PaidOut = roundMoney(statement.Totals.PaidOut)
+
+	return statement, nil
+}
+
+// money formats an amount for the PDF statement.
+func money(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+// StatementPDF renders the statement for printing.
+func StatementPDF(s Statement, ownerName string) []byte {
+	doc := pdf.New()
+	doc.Text(16, true, "Uley - owner statement "+s.Month)
+	doc.Text(10, false, ownerName)
+	doc.Text(10, false, "All amounts in "+s.Currency)
+	doc.Space(12)
+
+	columns := func(rent, dates, gross, refunded, fee, net string) []pdf.Column {
+		return []pdf.Column{
+			{X: pdf.Margin, Width: 150, Text: rent},
+			{X: 205, Width: 120, Text: dates},
+			{X: 325, Width: 55, Text: gross, Right: true},
+			{X: 385, Width: 50, Text: refunded, Right: true},
+			{X: 440, Width: 50, Text: fee, Right: true},
+			{X: 495, Width: 50, Text: net, Right: true},
+		}
+	}
+	doc.Row(8, true, columns("Item / rent", "Dates", "Gross", "Refund", "Fee", "Net")...)
+	for _, r := range s.Rents {
+		dates := ""
+		if len(r.DateStart) >= 10 && len(r.DateEnd) >= 10 {
+			dates = r.DateStart[:10] + " - " + r.DateEnd[:10]
+		}
+		doc.Row(8, false, columns(r.Title, dates, money(r.Gross), money(r.Refunded), money(r.Commission), money(r.Net))...)
+		doc.Row(7, false, pdf.Column{X: pdf.Margin + 8, Width: 150, Text: r.Rent})
+	}
+	if len(s.Rents) == 0 {
+		doc.Text(8, false, "No rents this month.")
+	}
+	doc.Space(6)
+	t := s.Totals
+	doc.Row(8, true, columns("Total", "", money(t.Gross), money(t.Refunded), money(t.Commission), money(t.Net))...)
+
+	doc.Space(12)
+	doc.Text(11, true, "Payouts")
+	for _, p := range s.Payouts {
+		created := p.Created
+		if len(created) >= 10 {
+			created = created[:10]
+		}
+		doc.Row(8, false,
+			pdf.Column{X: pdf.Margin, Width: 150, Text: p.Id},
+			pdf.Column{X: 205, Width: 120, Text: created + " " + p.Status},
+			pdf.Column{X: 495, Width: 50, Text: money(p.Amount), Right: true},
+		)
+	}
+	if len(s.Payouts) == 0 {
+		doc.Text(8, false, "No payouts this month.")
+	}
+	doc.Row(8, true,
+		pdf.Column{X: pdf.Margin, Width: 150, Text: "Paid out"},
+		pdf.Column{X: 495, Width: 50, Text: money(t.PaidOut), Right: true},
+	)
+
+	return doc.Bytes()
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// tagsSeparator joins normalized tags in items.tags.
+	tagsSeparator = ", "
+
+	tagNameMax       = 50
+	defaultTagsLimit = 10
+)
+
+// usageCountSQL counts the items linked to the tag.
+const usageCountSQL = "(SELECT COUNT(*) FROM [[items]], json_each([[items.item_tags]]) WHERE json_each.value = [[tags.id]])"
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+type TagSuggestion struct {
+	ID         string `db:"id" json:"id"`
+	Name       string `db:"name" json:"name"`
+	UsageCount int    `db:"usage_count" json:"usage_count"`
+}
+
+// NormalizeTag lowercases the tag, folds ё and collapses inner spaces.
+func NormalizeTag(tag string) string {
+	return strings.Join(strings.Fields(yoReplacer.Replace(strings.ToLower(tag))), " ")
+}
+
+// NormalizeTags splits a comma separated list into unique normalized tags,
+// keeping the original order.
+func NormalizeTags(raw string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		tag := NormalizeTag(part)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// NormalizeItemTags rewrites items.tags in the canonical "a, b" form.
+func NormalizeItemTags(item *core.Record) {
+	item.Set("tags", strings.Join(NormalizeTags(item.GetString("tags")), tagsSeparator))
+}
+
+// SyncItemTags links the item to the tag records of its normalized tags,
+// creating the missing ones. It returns the tags the item was linked to
+// before, their usage counts need a recount too.
+func SyncItemTags(app core.App, item *core.Record) ([]string, error) {
+	// older migrations save items before the tags collection exists
+	col, err := app.FindCollectionByNameOrId("tags")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	previous := []string{}
+	if !item.IsNew() {
+		previous = item.Original().GetStringSlice("item_tags")
+	}
+
+	names := NormalizeTags(item.GetString("tags"))
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		tag, err := app.FindFirstRecordByData(col, "name", name)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if tag == nil {
+			tag = core.NewRecord(col)
+			tag.Set("name", name)
+			if err := app.Save(tag); err != nil {
+				return nil, err
+			}
+		}
+		ids = append(ids, tag.Id)
+	}
+	item.Set("item_tags", ids)
+
+	return previous, nil
+}
+
+// RecountTags refreshes usage_count of the given tags.
+func RecountTags(app core.App, tagIDs []string) error {
+	if len(tagIDs) == 0 {
+		return nil
+	}
+	ids := make([]any, len(tagIDs))
+	for i, id := range tagIDs {
+		ids[i] = id
+	}
+	_, err := app.DB().Update("tags",
+		dbx.Params{"usage_count": dbx.NewExp(usageCountSQL)},
+		dbx.In("id", ids...),
+	).Execute()
+	return err
+}
+
+// tagsExpr matches items linked to all (or any) of the tags.
+func tagsExpr(tags []string, matchAll bool) dbx.Expression {
+	exprs := make([]dbx.Expression, 0, len(tags))
+	for i, tag := range tags {
+		param := "tag" + strconv.Itoa(i)
+		exprs = append(exprs, dbx.NewExp(
+			"EXISTS (SELECT 1 FROM json_each([[items.item_tags]]) tag_ref"+
+				" INNER JOIN [[tags]] ON [[tags.id]] = tag_ref.value WHERE [[tags.name]] = {:"+param+"})",
+			dbx.Params{param: tag},
+		))
+	}
+	if matchAll {
+		return dbx.And(exprs...)
+	}
+	return dbx.Or(exprs...)
+}
+
+// SuggestTags autocompletes tag names by prefix, most used first.
+func SuggestTags(app core.App, q string, limit int) ([]TagSuggestion, error) {
+	if limit <= 0 {
+		limit = defaultTagsLimit
+	}
+
+	query := app.DB().Select("id", "name", "usage_count").
+		From("tags").
+		Where(dbx.NewExp("[[usage_count]] > 0"))
+	if prefix := NormalizeTag(q); prefix != "" {
+		query.AndWhere(dbx.NewExp(
+			"[[name]] LIKE {:prefix} ESCAPE '\\'",
+			dbx.Params{"prefix": likeEscaper.Replace(prefix) + "%"},
+		))
+	}
+
+	tags := []TagSuggestion{}
+	err := query.OrderBy("usage_count DESC", "name ASC").Limit(int64(limit)).All(&tags)
+	return tags, err
+}
+
+// PopularTags returns the most used tags, counted within the category when
+// categoryID is set.
+func PopularTags(app core.App, categoryID string, limit int) ([]TagSuggestion, error) {
+	if limit <= 0 {
+		limit = defaultTagsLimit
+	}
+
+	tags := []TagSuggestion{}
+	if categoryID == "" {
+		err := app.DB().Select("id", "name", "usage_count").
+			From("tags").
+			Where(dbx.NewExp("[[usage_count]] > 0")).
+			OrderBy("usage_count DESC", "name ASC").
+			Limit(int64(limit)).
+			All(&tags)
+		return tags, err
+	}
+
+	err := app.DB().Select("tags.id AS id", "tags.name AS name", "COUNT(*) AS usage_count").
+		From("items").
+		InnerJoin("json_each(items.item_tags) tag_ref", nil).
+		InnerJoin("tags", dbx.NewExp("[[tags.id]] = tag_ref.value")).
+		Where(dbx.HashExp{"items.category": categoryID}).
+		GroupBy("tags.id").
+		OrderBy("usage_count DESC", "name ASC").
+		Limit(int64(limit)).
+		All(&tags)
+	return tags, err
+}